@@ -0,0 +1,101 @@
+package main
+
+import (
+	"github.com/natefinch/gocog/processor"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// cleanCommand is gocog clean, which removes the temporary files left by interrupted runs.
+type cleanCommand struct {
+	DryRun bool       `short:"n" long:"dry-run" description:"Print the leftover files that would be removed without removing them"`
+	Log    logOptions `group:"Logging Options"`
+}
+
+// Usage returns the usage line for the command's help.
+func (c *cleanCommand) Usage() string {
+	return "[OPTIONS] [DIR ...]"
+}
+
+// Execute removes the leftover temporary files in the directories, or the current directory
+// if none are given, and all the directories below them. Leftovers of files that another gocog
+// is processing right now are left alone.
+func (c *cleanCommand) Execute(dirs []string) error {
+	if err := setLogger(&c.Log); err != nil {
+		return err
+	}
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	failed := false
+	for _, root := range dirs {
+		// find the directories first, since cleaning changes what's in them
+		var found []string
+		err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			if name != root && skipDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			found = append(found, name)
+			return nil
+		})
+		if err != nil {
+			slog.Error("Error searching", "dir", root, "err", err)
+			failed = true
+		}
+		for _, dir := range found {
+			if !c.clean(dir) {
+				failed = true
+			}
+		}
+	}
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+// clean removes the leftover temporary files in dir, and reports whether it succeeded.
+func (c *cleanCommand) clean(dir string) bool {
+	found, err := processor.FindLeftovers(dir)
+	if err != nil {
+		slog.Error("Error searching", "dir", dir, "err", err)
+		return false
+	}
+	files := make([]string, 0, len(found))
+	for file := range found {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	ok := true
+	for _, file := range files {
+		names := found[file]
+		if c.DryRun {
+			for _, name := range names {
+				slog.Info("Would remove", "leftover", name)
+			}
+			continue
+		}
+		switch err := processor.RemoveLeftovers(file, names); err {
+		case nil:
+			for _, name := range names {
+				slog.Info("Removed", "leftover", name)
+			}
+		case processor.InUse:
+			slog.Info("Skipping leftovers of a file another gocog is processing", "file", file)
+		default:
+			slog.Error("Error removing leftovers", "file", file, "err", err)
+			ok = false
+		}
+	}
+	return ok
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// listFiles returns the files below dir, relative to it in slash separated form, in order.
+func listFiles(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		files = append(files, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = relFiles(t, dir, files)
+	sort.Strings(files)
+	return files
+}
+
+func TestClean(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"a.txt":                           "",
+		"a.txt_cog_0123abcd":              "",
+		"sub/b.txt":                       "",
+		"sub/cog_b.txt_cog_1_0123abcd.go": "",
+		"sub/b.txt_cog.lock":              "",
+		// near misses that belong to the user
+		"a.txt_cog_notes":      "",
+		"orphan_cog_0123abcd":  "",
+		"notes_cog.lock":       "notes",
+		"cog_a.txt_cog_1_2.go": "",
+		// version control directories aren't searched
+		".git/c.txt":              "",
+		".git/c.txt_cog_0123abcd": "",
+	})
+	leftovers := []string{"a.txt_cog_0123abcd", "sub/b.txt_cog.lock", "sub/cog_b.txt_cog_1_0123abcd.go"}
+	all := listFiles(t, dir)
+
+	out, err := captureStderr(t, func() error { return (&cleanCommand{DryRun: true}).Execute([]string{dir}) })
+	if err != nil {
+		t.Fatalf("Clean: unexpected error with --dry-run: %v", err)
+	}
+	for _, name := range leftovers {
+		if !strings.Contains(out, "Would remove") || !strings.Contains(out, filepath.Join(dir, filepath.FromSlash(name))) {
+			t.Errorf("Clean: Expected --dry-run to list %s, Got:\n%s", name, out)
+		}
+	}
+	if files := listFiles(t, dir); !reflect.DeepEqual(files, all) {
+		t.Errorf("Clean: Expected --dry-run to remove nothing, Got %q", files)
+	}
+
+	out, err = captureStderr(t, func() error { return (&cleanCommand{}).Execute([]string{dir}) })
+	if err != nil {
+		t.Fatalf("Clean: unexpected error: %v", err)
+	}
+	var left []string
+	for _, name := range all {
+		removed := false
+		for _, l := range leftovers {
+			removed = removed || name == l
+		}
+		if !removed {
+			left = append(left, name)
+		}
+	}
+	if files := listFiles(t, dir); !reflect.DeepEqual(files, left) {
+		t.Errorf("Clean: Expected only the leftovers removed, leaving %q, Got %q", left, files)
+	}
+	if strings.Count(out, "Removed") != len(leftovers) {
+		t.Errorf("Clean: Expected each leftover removed to be logged, Got:\n%s", out)
+	}
+}
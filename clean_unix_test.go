@@ -0,0 +1,50 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestCleanSkipsLockedFile(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{"a.txt": "", "a.txt_cog_0123abcd": "", "b.txt": "", "b.txt_cog_0123abcd": ""})
+
+	// another gocog is processing a.txt, so its temporary file isn't left over
+	lock, err := os.OpenFile(filepath.Join(dir, "a.txt_cog.lock"), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := captureStderr(t, func() error { return (&cleanCommand{}).Execute([]string{dir}) })
+	if err != nil {
+		t.Fatalf("CleanSkipsLockedFile: unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "Skipping") {
+		t.Errorf("CleanSkipsLockedFile: Expected the locked file to be skipped, Got:\n%s", out)
+	}
+	for _, name := range []string{"a.txt_cog_0123abcd", "a.txt_cog.lock"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("CleanSkipsLockedFile: Expected %s to be left alone, Got %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.txt_cog_0123abcd")); !os.IsNotExist(err) {
+		t.Errorf("CleanSkipsLockedFile: Expected the leftover of b.txt to be removed, Got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jessevdk/go-flags"
+)
+
+// errFailed is returned by commands that have already reported why they failed.
+var errFailed = errors.New("failed")
+
+// usageError is an error in how gocog was called, which is reported along with the command's help.
+type usageError struct {
+	error
+}
+
+// processCommand is a command that processes files, such as run or check.
+type processCommand struct {
+	// execute runs the command with the options in mode, which give the command its behavior,
+	// and args, the command line after the command name. The command line is parsed again for
+	// each file, so it's kept as is.
+	execute func(mode, args []string) error
+	mode    []string
+	args    []string
+}
+
+// Usage returns the usage line for the command's help.
+func (c *processCommand) Usage() string {
+	return "[OPTIONS] [INFILE | DIR | GLOB | @FILELIST] ..."
+}
+
+// Execute runs the command over the targets on the command line.
+func (c *processCommand) Execute(args []string) error {
+	return c.execute(c.mode, c.args)
+}
+
+// versionCommand is gocog version.
+type versionCommand struct {
+	Log logOptions `group:"Logging Options"`
+}
+
+// Execute prints the version of gocog.
+func (c *versionCommand) Execute(args []string) error {
+	if err := setLogger(&c.Log); err != nil {
+		return err
+	}
+	fmt.Printf(version, buildDate())
+	return nil
+}
+
+// hookCommand is gocog hook, which only groups its subcommands.
+type hookCommand struct{}
+
+// hookInstallCommand is gocog hook install.
+type hookInstallCommand struct {
+	Force bool       `short:"f" long:"force" description:"Replace an existing pre-commit hook not installed by gocog"`
+	Log   logOptions `group:"Logging Options"`
+}
+
+// Usage returns the usage line for the command's help.
+func (c *hookInstallCommand) Usage() string {
+	return "[OPTIONS] [-- GOCOG ARGS...]"
+}
+
+// Execute installs the pre-commit hook, passing it the args.
+func (c *hookInstallCommand) Execute(args []string) error {
+	if err := setLogger(&c.Log); err != nil {
+		return err
+	}
+	if err := installHook(args, c.Force); err != nil {
+		return fmt.Errorf("Error installing pre-commit hook: %s", err)
+	}
+	return nil
+}
+
+// processCommands describes each command that processes files: its name, its help, the function
+// that runs it, the options that give it its behavior, and the groups of options it accepts.
+// Hidden groups are accepted but left out of the command's help, so older command lines keep working.
+var processCommands = []struct {
+	name, short, long string
+	execute           func(mode, args []string) error
+	mode              []string
+	groups            []string
+	hidden            []string
+}{
+	{
+		name:    "run",
+		execute: process,
+		short:   "Run the generators and write their output (the default)",
+		long: "Runs gocog over each infile. Directories and globs are searched recursively for files. " +
+			"Strings prepended with @ are assumed to be files continaing newline delimited lists of gocog command lines. " +
+			"Command line options are passed to each command line in the file list, but options on the file list line " +
+			"will override command line options. You may have filelists specified inside filelist files. " +
+			"Default options may be set in a .gocog.json file in the current directory or any directory above it.",
+		groups: []string{"Logging Options", "Block Options", "Generator Options", "Job Options", "Execution Options",
+			"Write Options", "Search Options", "Report Options", "Config Options"},
+		hidden: []string{"Check Options", "Diff Options", "Mode Options"},
+	},
+	{
+		name:    "check",
+		execute: process,
+		short:   "Report files whose generated output is out of date",
+		long: "Runs the generators over each infile without writing anything, and exits with an error " +
+			"if any file's generated output is out of date, printing the command that regenerates it.",
+		mode: []string{"--check"},
+		groups: []string{"Check Options", "Logging Options", "Block Options", "Generator Options", "Job Options",
+			"Execution Options", "Search Options", "Report Options", "Config Options"},
+	},
+	{
+		name:    "diff",
+		execute: process,
+		short:   "Print the changes the generators would make",
+		long: "Runs the generators over each infile without writing anything, and prints a unified diff " +
+			"of the changes instead.",
+		mode: []string{"--dry-run"},
+		groups: []string{"Diff Options", "Logging Options", "Block Options", "Generator Options", "Job Options",
+			"Execution Options", "Search Options", "Report Options", "Config Options"},
+	},
+	{
+		name:    "excise",
+		execute: process,
+		short:   "Remove the generated output without running the generators",
+		long:    "Removes the generated output from each infile, leaving the generator code in place.",
+		mode:    []string{"--excise"},
+		groups: []string{"Logging Options", "Block Options", "Job Options", "Write Options", "Search Options",
+			"Report Options", "Config Options"},
+	},
+	{
+		name:    "list",
+		execute: listBlocks,
+		short:   "List the gocog blocks in files without running them",
+		long: "Lists every gocog block in each infile, with its lines, the command that runs it, " +
+			"the prefix removed from its generator code, and the size of its code and current output, " +
+			"as a table or as JSON.",
+		groups: []string{"Format Options", "Logging Options", "Block Options", "Generator Options", "Search Options", "Config Options"},
+	},
+	{
+		name:    "vet",
+		execute: vetFiles,
+		short:   "Report malformed or suspicious blocks without running them",
+		long: "Checks the markers of every gocog block in each infile without running any generators, " +
+			"and reports start markers with no end, nested start markers, end markers outside any block, " +
+			"blocks with no room for output, markers inside string literals, markers whose prefix differs " +
+			"from their block's, and lines of generator code missing the prefix. Findings are printed as " +
+			"text, JSON or SARIF, and gocog vet fails if there are any.",
+		groups: []string{"Format Options", "Logging Options", "Block Options", "Search Options", "Config Options"},
+	},
+}
+
+// newParser returns the parser for gocog's commands, with the command line after the command name
+// stored in the command that will run, since processing commands parse it again for each file.
+func newParser(args []string) *flags.Parser {
+	p := flags.NewParser(nil, flags.HelpFlag|flags.PassDoubleDash|flags.AllowBoolValues)
+	p.LongDescription = "Generates text from sourcecode inlined in files. " +
+		"gocog [OPTIONS] [INFILE | DIR | GLOB | @FILELIST] ... is short for gocog run with the same arguments. " +
+		"Use gocog COMMAND --help for the options of each command."
+
+	for _, pc := range processCommands {
+		c := &processCommand{execute: pc.execute, mode: pc.mode}
+		if len(args) > 0 && args[0] == pc.name {
+			c.args = args[1:]
+		}
+		cmd := mustAdd(p.AddCommand(pc.name, pc.short, pc.long, c))
+		// the options parsed here only check the command line, which is parsed again for each file,
+		// but they're set to the defaults so the help shows them
+		opts := defaultOptions()
+		groups := opts.groups()
+		for _, name := range pc.groups {
+			mustAddGroup(cmd.AddGroup(name, "", groups[name]))
+		}
+		for _, name := range pc.hidden {
+			mustAddGroup(cmd.AddGroup(name, "", groups[name])).Hidden = true
+		}
+	}
+
+	mustAdd(p.AddCommand("clean", "Remove temporary files left by interrupted runs",
+		"Removes the temporary output and generator files left behind by gocog runs that were interrupted, "+
+			"in each directory and all the directories below it, or the current directory if none are given. "+
+			"Only files named exactly like gocog's temporary files, made for a file that still exists, are removed, "+
+			"lock files only if they are empty, and the files of any file that another gocog is processing are left alone.",
+		&cleanCommand{}))
+	mustAdd(p.AddCommand("version", "Display the version of gocog", "Displays the version of gocog.", &versionCommand{}))
+
+	hook := mustAdd(p.AddCommand("hook", "Manage the git pre-commit hook", "Manages the git pre-commit hook.", &hookCommand{}))
+	mustAdd(hook.AddCommand("install", "Install a pre-commit hook that checks staged files",
+		"Installs a git pre-commit hook that runs gocog check --staged on the files being committed, "+
+			"and blocks the commit if their generated sections are out of date. Any args after -- are added "+
+			"to the gocog command line in the hook, for instance to name a filelist.",
+		&hookInstallCommand{}))
+	return p
+}
+
+// mustAdd returns the command added to the parser, and panics if it couldn't be added,
+// which can only happen if the command's options are malformed.
+func mustAdd(cmd *flags.Command, err error) *flags.Command {
+	if err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+// mustAddGroup returns the group added to a command, and panics if it couldn't be added,
+// which can only happen if the group's options are malformed.
+func mustAddGroup(g *flags.Group, err error) *flags.Group {
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configName is the name of the project config file, found by searching up from the working directory.
+const configName = ".gocog.json"
+
+// projectConfig holds the settings from a project config file.
+// Options are given as a map from the long name of the command line flag to its value.
+// Settings from the config are overridden by the command line, which are in turn
+// overridden by the options on a filelist line.
+type projectConfig struct {
+	// Options are the default options for every file.
+	Options optionSet `json:"options"`
+	// Languages are named sets of options for running generators in a particular language.
+	Languages map[string]optionSet `json:"languages"`
+	// Markers are options for files by extension, normally the start and end marks
+	// that suit the comment syntax of the file. Extensions may be given with or without
+	// the leading dot, which is added when the config is loaded.
+	Markers map[string]optionSet `json:"markers"`
+	// Targets are the files, directories and globs processed when none are given on the command line.
+	Targets []string `json:"targets"`
+	// Overrides are options for files matching particular globs. Later overrides take precedence.
+	Overrides []override `json:"overrides"`
+
+	// dir is the directory holding the config file. Paths in the config are relative to it.
+	dir string
+}
+
+// override holds the settings for files matching any of a list of globs.
+type override struct {
+	Paths    []string  `json:"paths"`
+	Language string    `json:"language"`
+	Options  optionSet `json:"options"`
+}
+
+// optionSet maps the long names of command line flags to their values.
+type optionSet map[string]interface{}
+
+// pathOptions are the options whose values are paths, which are relative to the directory holding the config file.
+var pathOptions = []string{"files-from", "patch", "report-file", "trace"}
+
+// resolvePaths makes the relative paths in the path options of the set relative to dir instead.
+// A files-from of - is stdin, so it's left alone.
+func (s optionSet) resolvePaths(dir string) {
+	for _, name := range pathOptions {
+		if v, ok := s[name].(string); ok && v != "" && v != "-" && !filepath.IsAbs(v) {
+			s[name] = relative(filepath.Join(dir, filepath.FromSlash(v)))
+		}
+	}
+}
+
+// args converts the options to command line arguments, in a stable order.
+func (s optionSet) args() ([]string, error) {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		values := []interface{}{s[name]}
+		if list, ok := s[name].([]interface{}); ok {
+			values = list
+		}
+		for _, v := range values {
+			switch v := v.(type) {
+			case bool:
+				// false turns off a flag turned on by a layer below
+				args = append(args, "--"+name+"="+strconv.FormatBool(v))
+			case string:
+				args = append(args, "--"+name+"="+v)
+			case float64:
+				args = append(args, "--"+name+"="+strconv.FormatFloat(v, 'f', -1, 64))
+			default:
+				return nil, fmt.Errorf("Invalid value for option '%s': %v", name, v)
+			}
+		}
+	}
+	return args, nil
+}
+
+// findConfig searches for a config file in the working directory and each directory above it,
+// returning the empty string if there isn't one.
+func findConfig() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		name := filepath.Join(dir, configName)
+		if _, err := os.Stat(name); err == nil {
+			return name, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// loadConfig reads and checks the named config file.
+func loadConfig(name string) (*projectConfig, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := &projectConfig{}
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("Error reading config file '%s': %s", name, err)
+	}
+	if c.dir, err = filepath.Abs(filepath.Dir(name)); err != nil {
+		return nil, err
+	}
+
+	for _, o := range c.Overrides {
+		if _, ok := c.Languages[o.Language]; o.Language != "" && !ok {
+			return nil, fmt.Errorf("Error in config file '%s': unknown language '%s'", name, o.Language)
+		}
+	}
+	// markers are looked up by extension, so "go" and ".go" must be the same key
+	markers := make(map[string]optionSet, len(c.Markers))
+	for e, s := range c.Markers {
+		ext := e
+		if ext != "" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if _, ok := markers[ext]; ok {
+			return nil, fmt.Errorf("Error in config file '%s': markers for '%s' are given more than once", name, ext)
+		}
+		markers[ext] = s
+	}
+	c.Markers = markers
+	// check that every set of options is valid now, rather than when the first file uses it
+	sets := []optionSet{c.Options}
+	for _, s := range c.Languages {
+		sets = append(sets, s)
+	}
+	for _, s := range c.Markers {
+		sets = append(sets, s)
+	}
+	for _, o := range c.Overrides {
+		sets = append(sets, o.Options)
+	}
+	for _, s := range sets {
+		s.resolvePaths(c.dir)
+		args, err := s.args()
+		if err == nil {
+			_, _, err = parseOptions(args)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error in config file '%s': %s", name, err)
+		}
+	}
+	return c, nil
+}
+
+// base returns the arguments for the options that apply to every file.
+func (c *projectConfig) base() ([][]string, error) {
+	if c == nil {
+		return nil, nil
+	}
+	args, err := c.Options.args()
+	if err != nil {
+		return nil, err
+	}
+	return [][]string{args}, nil
+}
+
+// argsFor returns the arguments for the options that apply to the named file,
+// from lowest to highest precedence.
+func (c *projectConfig) argsFor(name string) ([][]string, error) {
+	if c == nil {
+		return nil, nil
+	}
+	layers, err := c.base()
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := c.Markers[filepath.Ext(name)]; ok {
+		args, err := s.args()
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, args)
+	}
+
+	rel := name
+	if abs, err := filepath.Abs(name); err == nil {
+		if r, err := filepath.Rel(c.dir, abs); err == nil {
+			rel = r
+		}
+	}
+	rel = filepath.ToSlash(rel)
+	for _, o := range c.Overrides {
+		matched := false
+		for _, pattern := range o.Paths {
+			if matchName(pattern, rel) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if o.Language != "" {
+			args, err := c.Languages[o.Language].args()
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, args)
+		}
+		args, err := o.Options.args()
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, args)
+	}
+	return layers, nil
+}
+
+// targets returns the config's targets relative to the working directory where possible.
+func (c *projectConfig) targets() []string {
+	if c == nil {
+		return nil
+	}
+	targets := make([]string, 0, len(c.Targets))
+	for _, t := range c.Targets {
+		targets = append(targets, relative(filepath.Join(c.dir, filepath.FromSlash(t))))
+	}
+	return targets
+}
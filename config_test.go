@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type OptionSetData struct {
+	set  optionSet
+	args []string
+}
+
+func TestOptionSetArgs(t *testing.T) {
+	tests := []OptionSetData{
+		{optionSet{}, nil},
+		{optionSet{"serial": true}, []string{"--serial=true"}},
+		{optionSet{"serial": false}, []string{"--serial=false"}},
+		{optionSet{"jobs": 4.0, "cmd": "python"}, []string{"--cmd=python", "--jobs=4"}},
+		{optionSet{"args": []interface{}{"run", "%s"}}, []string{"--args=run", "--args=%s"}},
+	}
+
+	for i, test := range tests {
+		args, err := test.set.args()
+		if err != nil {
+			t.Errorf("OptionSetArgs Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("OptionSetArgs Test %d: Expected %q, Got %q", i, test.args, args)
+		}
+	}
+
+	if _, err := (optionSet{"cmd": map[string]interface{}{}}).args(); err == nil {
+		t.Error("OptionSetArgs: Expected an error for an object value")
+	}
+}
+
+// writeConfig writes a config file with the given contents to dir and returns its name.
+func writeConfig(t *testing.T, dir, contents string) string {
+	name := filepath.Join(dir, configName)
+	if err := ioutil.WriteFile(name, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := loadConfig(writeConfig(t, dir, `{
+		"options": {"eof": true, "jobs": 4},
+		"languages": {"python": {"cmd": "python", "args": ["%s"], "ext": ".py"}},
+		"markers": {"md": {"startmark": "{{{", "endmark": "}}}"}},
+		"targets": ["**/*.go", "README.md"],
+		"overrides": [{"paths": ["scripts/**"], "language": "python", "options": {"trace": "out/trace.json"}}]
+	}`))
+	if err != nil {
+		t.Fatalf("LoadConfig: unexpected error: %v", err)
+	}
+	if c.dir != dir {
+		t.Errorf("LoadConfig: Expected dir %q, Got %q", dir, c.dir)
+	}
+	if !reflect.DeepEqual(c.Targets, []string{"**/*.go", "README.md"}) {
+		t.Errorf("LoadConfig: Expected targets from the file, Got %q", c.Targets)
+	}
+	if len(c.Overrides) != 1 || c.Overrides[0].Language != "python" {
+		t.Errorf("LoadConfig: Expected an override for python, Got %+v", c.Overrides)
+	}
+	if _, ok := c.Markers[".md"]; !ok || len(c.Markers) != 1 {
+		t.Errorf("LoadConfig: Expected the markers for md under .md, Got %v", c.Markers)
+	}
+	// paths are relative to the config file, not the working directory
+	if trace, _ := c.Overrides[0].Options["trace"].(string); filepath.Clean(trace) != filepath.Join(dir, "out", "trace.json") {
+		t.Errorf("LoadConfig: Expected the trace path resolved against %q, Got %q", dir, trace)
+	}
+
+	c, err = loadConfig(writeConfig(t, dir, `{"options": {"patch": "/tmp/a.patch", "files-from": "-", "report-file": "report.xml"}}`))
+	if err != nil {
+		t.Fatalf("LoadConfig: unexpected error: %v", err)
+	}
+	expected := optionSet{"patch": "/tmp/a.patch", "files-from": "-", "report-file": filepath.Join(dir, "report.xml")}
+	if !reflect.DeepEqual(c.Options, expected) {
+		t.Errorf("LoadConfig: Expected %v, Got %v", expected, c.Options)
+	}
+
+	bad := map[string]string{
+		"unknown field":    `{"option": {}}`,
+		"unknown language": `{"overrides": [{"paths": ["*.py"], "language": "perl"}]}`,
+		"unknown option":   `{"options": {"nosuch": true}}`,
+		"invalid value":    `{"options": {"jobs": "many"}}`,
+		"invalid marker":   `{"markers": {".md": {"startmark": {}}}}`,
+		"duplicate marker": `{"markers": {"md": {"startmark": "{{{"}, ".md": {"startmark": "<<<"}}}`,
+		"invalid override": `{"overrides": [{"paths": ["*.go"], "options": {"serial": null}}]}`,
+		"invalid json":     `{"options": `,
+	}
+	for desc, contents := range bad {
+		if _, err := loadConfig(writeConfig(t, dir, contents)); err == nil {
+			t.Errorf("LoadConfig: Expected an error for %s", desc)
+		} else if !strings.Contains(err.Error(), configName) {
+			t.Errorf("LoadConfig: Expected the error for %s to name the config file, Got: %v", desc, err)
+		}
+	}
+}
+
+func TestArgsFor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &projectConfig{
+		Options:   optionSet{"serial": true},
+		Languages: map[string]optionSet{"python": {"cmd": "python"}},
+		Markers:   map[string]optionSet{".md": {"startmark": "{{{"}},
+		Overrides: []override{
+			{Paths: []string{"scripts/**"}, Language: "python", Options: optionSet{"ext": ".py"}},
+			{Paths: []string{"*.md"}, Options: optionSet{"serial": false}},
+		},
+		dir: dir,
+	}
+
+	layers, err := c.argsFor(filepath.Join(dir, "scripts", "gen.go"))
+	if err != nil {
+		t.Fatalf("ArgsFor: unexpected error: %v", err)
+	}
+	expected := [][]string{{"--serial=true"}, {"--cmd=python"}, {"--ext=.py"}}
+	if !reflect.DeepEqual(layers, expected) {
+		t.Errorf("ArgsFor: Expected %q, Got %q", expected, layers)
+	}
+
+	layers, err = c.argsFor(filepath.Join(dir, "docs", "README.md"))
+	if err != nil {
+		t.Fatalf("ArgsFor: unexpected error: %v", err)
+	}
+	expected = [][]string{{"--serial=true"}, {"--startmark={{{"}, {"--serial=false"}}
+	if !reflect.DeepEqual(layers, expected) {
+		t.Errorf("ArgsFor: Expected %q, Got %q", expected, layers)
+	}
+
+	// later layers override earlier ones, and the command line overrides the config
+	opts, _, err := parseOptions(layers...)
+	if err != nil {
+		t.Fatalf("ArgsFor: unexpected error parsing layers: %v", err)
+	}
+	if opts.Serial || opts.StartMark != "{{{" {
+		t.Errorf("ArgsFor: Expected serial turned off and startmark {{{, Got %v and %q", opts.Serial, opts.StartMark)
+	}
+	if opts, _, err = parseOptions(append(layers, []string{"--serial"})...); err != nil || !opts.Serial {
+		t.Errorf("ArgsFor: Expected the command line to turn serial back on, Got %v, %v", opts.Serial, err)
+	}
+
+	c.Markers[".md"] = optionSet{"startmark": []interface{}{map[string]interface{}{}}}
+	if _, err := c.argsFor(filepath.Join(dir, "README.md")); err == nil {
+		t.Error("ArgsFor: Expected an error for an invalid marker section")
+	}
+
+	var none *projectConfig
+	if layers, err := none.argsFor("a.go"); layers != nil || err != nil {
+		t.Errorf("ArgsFor: Expected nothing from a nil config, Got %q, %v", layers, err)
+	}
+}
@@ -9,10 +9,11 @@
 //   fmt.Println("")
 //   fmt.Print("/", "*", "\n")
 //   fmt.Println("Command gocog creates an executable that will generate text from sourcecode inlined in another file.\n")
-//   cmd := exec.Command("gocog")
-
-//   cmd.Stdout = os.Stdout
-//   cmd.Run()
+//   for _, args := range [][]string{{"--help"}, {"run", "--help"}} {
+//     cmd := exec.Command("gocog", args...)
+//     cmd.Stdout = os.Stdout
+//     cmd.Run()
+//   }
 //   fmt.Print("*","/", "\n")
 //   fmt.Println("package documentation")
 // }
@@ -22,29 +23,109 @@
 Command gocog creates an executable that will generate text from sourcecode inlined in another file.
 
 Usage:
-  gocog [OPTIONS] [INFILE | @FILELIST] ...
+  gocog [OPTIONS] <command>
 
-  Runs gocog over each infile. 
-  Strings prepended with @ are assumed to be files continaing newline delimited lists of gocog command lines.
-  Command line options are passed to each command line in the file list, but options on the file list line
-  will override command line options. You may have filelists specified inside filelist files.
+Generates text from sourcecode inlined in files. gocog [OPTIONS] [INFILE | DIR
+| GLOB | @FILELIST] ... is short for gocog run with the same arguments. Use
+gocog COMMAND --help for the options of each command.
 
 Help Options:
-  -h, --help         Show this help message
-
-Application Options:
-  -z, --eof          The end marker can be assumed at eof.
-  -v, --verbose      enables verbose output
-  -q, --quiet        turns off all output
-  -S, --serial       Write to the specified cog files serially
-  -c, --cmd          The command used to run the generator code (go)
-  -a, --args         Comma separated arguments to cmd, %s for the code file
-                     ([run, %s])
-  -e, --ext          Extension to append to the generator filename (.go)
-  -M, --startmark    String that starts gocog statements ([[[)
-  -E, --endmark      String that ends gocog statements (]]])
-  -x, --excise       Excise all the generated output without running the
-                     generators.
-  -V, --version      Display the version of gocog
+  -h, --help  Show this help message
+
+Available commands:
+  check    Report files whose generated output is out of date
+  clean    Remove temporary files left by interrupted runs
+  diff     Print the changes the generators would make
+  excise   Remove the generated output without running the generators
+  hook     Manage the git pre-commit hook
+  list     List the gocog blocks in files without running them
+  run      Run the generators and write their output (the default)
+  version  Display the version of gocog
+  vet      Report malformed or suspicious blocks without running them
+
+Usage:
+  gocog [OPTIONS] run [OPTIONS] [INFILE | DIR | GLOB | @FILELIST] ...
+
+Runs gocog over each infile. Directories and globs are searched recursively for
+files. Strings prepended with @ are assumed to be files continaing newline
+delimited lists of gocog command lines. Command line options are passed to each
+command line in the file list, but options on the file list line will override
+command line options. You may have filelists specified inside filelist files.
+Default options may be set in a .gocog.json file in the current directory or
+any directory above it.
+
+Help Options:
+  -h, --help                 Show this help message
+
+[run command options]
+
+    Logging Options:
+      -v, --verbose          enables verbose output
+      -q, --quiet            turns off all output
+          --log-level=       Lowest level of the messages logged: debug, info,
+                             warn or error (overrides --verbose)
+          --log-format=      Format of the log written to stderr: text or json
+
+    Block Options:
+      -z, --eof              The end marker can be assumed at eof.
+      -M, --startmark=       String that starts gocog statements (default: [[[)
+      -E, --endmark=         String that ends gocog statements (default: ]]])
+
+    Generator Options:
+      -c, --cmd=             The command used to run the generator code
+                             (default: go)
+      -a, --args=            Comma separated arguments to cmd, %s for the code
+                             file (default: [run, %s])
+      -e, --ext=             Extension to append to the generator filename
+                             (default: .go)
+
+    Job Options:
+      -S, --serial           Write to the specified cog files serially
+      -j, --jobs=            Maximum number of files and generators processed
+                             at once (defaults to the number of CPUs)
+          --no-progress      Log each file instead of showing progress when
+                             stdout is a terminal
+
+    Execution Options:
+      -P, --parallel         Run the generators within each file concurrently
+          --stream-stderr    Write each line generators write to stderr as soon
+                             as it's written, instead of when they exit
+          --timings          Print the slowest blocks to stderr, and how long
+                             each step of generating them took
+          --trace=           Write a Chrome trace of the run to this file, for
+                             chrome://tracing or Perfetto
+
+    Write Options:
+          --preserve-owner   Give regenerated files the owner and group of the
+                             original
+          --preserve-xattrs  Copy the extended attributes of the original to
+                             regenerated files
+
+    Search Options:
+      -i, --include=         When searching directories, only process files
+                             matching this glob
+      -X, --exclude=         When searching directories, skip files and
+                             directories matching this glob
+          --gitignore        When searching directories, skip files ignored by
+                             git
+          --files-from=      Also process the files named in this file, one per
+                             line, or - for stdin
+      -0, --null             Names read by --files-from are separated by NUL
+                             characters instead of newlines
+          --changed          Only process files changed in git, or whose blocks
+                             depend on changed files
+          --since=           Only process files changed in git since this ref,
+                             or whose blocks depend on them (implies --changed)
+
+    Report Options:
+          --report=          Write a report of the run in this format: json,
+                             junit or sarif
+          --report-file=     Write the report to this file instead of stdout
+
+    Config Options:
+          --config=          Read default options from this config file instead
+                             of searching for .gocog.json
+          --no-config        Don't read a config file
+
 */
 package documentation
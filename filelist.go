@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"github.com/kballard/go-shellquote"
+	"github.com/natefinch/gocog/processor"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// source describes where a command line came from.
+type source struct {
+	// layers holds the args of the command lines that led to this one, which it overrides.
+	layers [][]string
+	// dir is the directory relative paths are resolved against, or empty for the working directory.
+	dir string
+	// chain holds the filelist lines that led to this command line, outermost first.
+	chain []location
+	// config is the project config whose options the command line overrides, or nil if there isn't one.
+	config *projectConfig
+}
+
+// location is a line in a filelist.
+type location struct {
+	file string
+	abs  string
+	line int
+}
+
+func (l location) String() string {
+	return fmt.Sprintf("%s:%d", l.file, l.line)
+}
+
+// filelistError is an error from a command line in a filelist.
+type filelistError struct {
+	// chain holds the filelist lines that led to the error, outermost first.
+	chain []location
+	err   error
+}
+
+// Error reports the innermost filelist line first, followed by the lines that included it.
+func (e *filelistError) Error() string {
+	msg := fmt.Sprintf("%s: %s", e.chain[len(e.chain)-1], e.err)
+	for i := len(e.chain) - 2; i >= 0; i-- {
+		msg += fmt.Sprintf("\n\tincluded from %s", e.chain[i])
+	}
+	return msg
+}
+
+// handleFilelist reads the file given and handles each command line in it.
+// Blank lines are skipped, a # at the start of a word starts a comment that runs to the end
+// of the line, and a line ending in a backslash is continued on the next line. Environment variables in the form $VAR or ${VAR} are
+// expanded, except inside single quotes, and relative paths are resolved against the
+// directory holding the filelist.
+// Errors from any line are returned as a *filelistError, and a filelist that includes
+// itself, directly or through other filelists, is an error.
+func handleFilelist(name string, opts *options, src source) ([]*processor.Processor, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+	for i, l := range src.chain {
+		if l.abs == abs {
+			cycle := make([]string, 0, len(src.chain)-i+1)
+			for _, l := range src.chain[i:] {
+				cycle = append(cycle, l.String())
+			}
+			cycle = append(cycle, name)
+			return nil, &filelistError{src.chain, fmt.Errorf("Filelist includes itself: %s", strings.Join(cycle, " -> "))}
+		}
+	}
+
+	slog.Debug("Processing filelist", "filelist", name)
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		if len(src.chain) > 0 {
+			return nil, &filelistError{src.chain, err}
+		}
+		return nil, err
+	}
+	lines := filelistLines(string(b))
+
+	procs := make([]*processor.Processor, 0, len(lines))
+	for _, line := range lines {
+		lineSrc := src
+		lineSrc.dir = filepath.Dir(name)
+		lineSrc.chain = append(src.chain[:len(src.chain):len(src.chain)], location{name, abs, line.num})
+
+		args, err := shellquote.Split(expandEnv(line.text))
+		if err != nil {
+			return nil, &filelistError{lineSrc.chain, fmt.Errorf("Error parsing command line: %s", err)}
+		}
+		p, err := handleCommandLine(args, lineSrc)
+		if err != nil {
+			if _, ok := err.(*filelistError); !ok {
+				err = &filelistError{lineSrc.chain, err}
+			}
+			return nil, err
+		}
+		procs = append(procs, p...)
+	}
+	return procs, nil
+}
+
+// filelistLine is a command line from a filelist, and the line number it starts on.
+type filelistLine struct {
+	num  int
+	text string
+}
+
+// filelistLines splits the contents of a filelist into command lines, joining lines
+// continued with a trailing backslash and dropping blank lines and comments.
+func filelistLines(contents string) []filelistLine {
+	var lines []filelistLine
+	var cur *filelistLine
+	for i, line := range strings.Split(contents, "\n") {
+		line = strings.TrimRight(stripComment(line), " \t\r")
+		if cur == nil {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			cur = &filelistLine{num: i + 1}
+		}
+		if strings.HasSuffix(line, "\\") {
+			cur.text += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		cur.text += line
+		lines = append(lines, *cur)
+		cur = nil
+	}
+	if cur != nil {
+		lines = append(lines, *cur)
+	}
+	return lines
+}
+
+// stripComment removes the comment from a line of a filelist. As in the shell, a comment starts
+// with a # at the start of a word, outside quotes, so a # inside a word or quotes is kept.
+// A comment ends the line, so a backslash at the end of it doesn't continue the line.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && quote != '\'':
+			i++
+		case (c == '\'' || c == '"') && quote == 0:
+			quote = c
+		case quote != 0 && c == quote:
+			quote = 0
+		case c == '#' && quote == 0 && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// expandEnv expands the environment variables in the form $VAR or ${VAR} in a filelist line,
+// as a shell would before splitting it into words, except that values are never split:
+// each value is quoted so that it stays part of the word it appears in, whatever spaces
+// or quotes it holds. Variables inside single quotes or escaped with a backslash are left alone.
+func expandEnv(line string) string {
+	b := &strings.Builder{}
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && quote != '\'' && i+1 < len(line):
+			b.WriteString(line[i : i+2])
+			i++
+			continue
+		case (c == '\'' || c == '"') && quote == 0:
+			quote = c
+		case quote != 0 && c == quote:
+			quote = 0
+		case c == '$' && quote != '\'':
+			name, n := envName(line[i+1:])
+			if n == 0 {
+				break
+			}
+			b.WriteString(quoteValue(os.Getenv(name), quote))
+			i += n
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// envName returns the name of the variable at the start of s, which follows a $,
+// and the length of its reference, or 0 if s doesn't start with a variable name.
+func envName(s string) (string, int) {
+	if strings.HasPrefix(s, "{") {
+		if end := strings.IndexByte(s, '}'); end > 1 {
+			return s[1:end], end + 1
+		}
+		return "", 0
+	}
+	n := 0
+	for n < len(s) && isNameChar(s[n], n == 0) {
+		n++
+	}
+	return s[:n], n
+}
+
+// isNameChar reports whether c can be part of a variable name, or start one if first is true.
+func isNameChar(c byte, first bool) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || !first && '0' <= c && c <= '9'
+}
+
+// quoteValue quotes the value of a variable so that it is taken literally when the line is split,
+// inside double quotes if quote is ", or standing on its own otherwise.
+func quoteValue(value string, quote byte) string {
+	if quote == '"' {
+		r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+		return r.Replace(value)
+	}
+	if value == "" {
+		return ""
+	}
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// resolve returns name relative to dir, unless it is absolute or dir is empty.
+// Filelists are prefixed with @, which stays at the front.
+func resolve(dir, name string) string {
+	if strings.HasPrefix(name, "@") {
+		return "@" + resolve(dir, name[1:])
+	}
+	if dir == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"github.com/kballard/go-shellquote"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type FilelistLinesData struct {
+	contents string
+	lines    []filelistLine
+}
+
+func TestFilelistLines(t *testing.T) {
+	tests := []FilelistLinesData{
+		{"", nil},
+		{"a.go\n", []filelistLine{{1, "a.go"}}},
+		{"a.go\nb.go", []filelistLine{{1, "a.go"}, {2, "b.go"}}},
+		{"# comment\n\n   \n  # indented comment\na.go\n", []filelistLine{{5, "a.go"}}},
+		{"a.go \t\r\nb.go\r\n", []filelistLine{{1, "a.go"}, {2, "b.go"}}},
+		{"-z \\\n  a.go \\\n  b.go\nc.go\n", []filelistLine{{1, "-z    a.go    b.go"}, {4, "c.go"}}},
+		// a comment ends the line, wherever it starts
+		{"a.go \\\n# comment\n", []filelistLine{{1, "a.go  "}}},
+		{"a.go # comment \\\nb.go\n", []filelistLine{{1, "a.go"}, {2, "b.go"}}},
+		{"a#b.go '#c.go' \"#d.go\" \\#e.go\n", []filelistLine{{1, `a#b.go '#c.go' "#d.go" \#e.go`}}},
+		{"a.go \\", []filelistLine{{1, "a.go  "}}},
+	}
+
+	for i, test := range tests {
+		if lines := filelistLines(test.contents); !reflect.DeepEqual(lines, test.lines) {
+			t.Errorf("FilelistLines Test %d: Expected %+v, Got %+v", i, test.lines, lines)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	abs, err := filepath.Abs("a.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		dir, name, resolved string
+	}{
+		{"", "a.go", "a.go"},
+		{"", "@list.txt", "@list.txt"},
+		{"lists", "a.go", filepath.Join("lists", "a.go")},
+		{"lists", "../a.go", "a.go"},
+		{"lists", "@more.txt", "@" + filepath.Join("lists", "more.txt")},
+		{"lists", abs, abs},
+		{"lists", "@" + abs, "@" + abs},
+	}
+
+	for i, test := range tests {
+		if resolved := resolve(test.dir, test.name); resolved != test.resolved {
+			t.Errorf("Resolve Test %d: Expected %q, Got %q", i, test.resolved, resolved)
+		}
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("GOCOG_DIR", "src dir")
+	t.Setenv("GOCOG_QUOTES", `it's "x"`)
+	t.Setenv("GOCOG_EMPTY", "")
+	tests := []struct {
+		line string
+		args []string
+	}{
+		{"$GOCOG_DIR/a.go", []string{"src dir/a.go"}},
+		{"${GOCOG_DIR}/a.go b.go", []string{"src dir/a.go", "b.go"}},
+		{`"$GOCOG_DIR/a.go"`, []string{"src dir/a.go"}},
+		{`'$GOCOG_DIR/a.go'`, []string{"$GOCOG_DIR/a.go"}},
+		{`\$GOCOG_DIR`, []string{"$GOCOG_DIR"}},
+		{`"it's $GOCOG_DIR"`, []string{"it's src dir"}},
+		{"--cmd=$GOCOG_QUOTES", []string{`--cmd=it's "x"`}},
+		{`"$GOCOG_QUOTES"`, []string{`it's "x"`}},
+		{"a.go $GOCOG_EMPTY b.go", []string{"a.go", "b.go"}},
+		{`"$GOCOG_EMPTY"`, []string{""}},
+		{"$GOCOG_UNSET_VARIABLE", []string{}},
+		{"cost$ 5$", []string{"cost$", "5$"}},
+		{"${", []string{"${"}},
+	}
+
+	for i, test := range tests {
+		args, err := shellquote.Split(expandEnv(test.line))
+		if err != nil {
+			t.Errorf("ExpandEnv Test %d: unexpected error splitting %q: %v", i, expandEnv(test.line), err)
+			continue
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("ExpandEnv Test %d: Expected %q, Got %q", i, test.args, args)
+		}
+	}
+}
+
+func TestHandleFilelistResolvesRelativePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"top.txt":         "-z @lists/inner.txt\n",
+		"lists/inner.txt": "../a.go\nsub/b.go\n",
+		"a.go":            "",
+		"lists/sub/b.go":  "",
+	})
+
+	opts := defaultOptions()
+	procs, err := handleFilelist(filepath.Join(dir, "top.txt"), &opts, source{})
+	if err != nil {
+		t.Fatalf("HandleFilelistResolvesRelativePaths: unexpected error: %v", err)
+	}
+	var files []string
+	for _, p := range procs {
+		files = append(files, p.File)
+		if !p.UseEOF {
+			t.Errorf("HandleFilelistResolvesRelativePaths: Expected %s to get the options of the including line", p.File)
+		}
+	}
+	expected := []string{filepath.Join(dir, "a.go"), filepath.Join(dir, "lists", "sub", "b.go")}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("HandleFilelistResolvesRelativePaths: Expected %q, Got %q", expected, files)
+	}
+}
+
+func TestHandleFilelistErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"a.txt":   "# a comment\n@b.txt\n",
+		"b.txt":   "\n@a.txt\n",
+		"bad.txt": "a.go\n@worse.txt\n",
+		"worse.txt": "a.go \\\n" +
+			"  --nosuch\n",
+		"quote.txt": "'a.go\n",
+		"empty.txt": "a.go \"$GOCOG_TEST_UNSET\"\n",
+	})
+	os.Unsetenv("GOCOG_TEST_UNSET")
+
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	bad, worse := filepath.Join(dir, "bad.txt"), filepath.Join(dir, "worse.txt")
+	tests := []struct {
+		name string
+		msg  string
+	}{
+		{a, b + ":2: Filelist includes itself: " + a + ":2 -> " + b + ":2 -> " + a + "\n" +
+			"\tincluded from " + a + ":2"},
+		{bad, worse + ":1: unknown flag `nosuch'\n" +
+			"\tincluded from " + bad + ":2"},
+		{filepath.Join(dir, "quote.txt"), filepath.Join(dir, "quote.txt") + ":1: Error parsing command line: Unterminated single-quoted string"},
+		{filepath.Join(dir, "empty.txt"), filepath.Join(dir, "empty.txt") + ":1: Empty file name"},
+	}
+
+	for i, test := range tests {
+		opts := defaultOptions()
+		_, err := handleFilelist(test.name, &opts, source{})
+		if _, ok := err.(*filelistError); !ok {
+			t.Errorf("HandleFilelistErrors Test %d: Expected a *filelistError, Got %#v", i, err)
+			continue
+		}
+		if err.Error() != test.msg {
+			t.Errorf("HandleFilelistErrors Test %d: Expected:\n%s\nGot:\n%s", i, test.msg, err)
+		}
+	}
+}
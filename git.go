@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/natefinch/gocog/processor"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// git runs git with the given arguments in dir and returns its output.
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	errOut := &bytes.Buffer{}
+	cmd.Stderr = errOut
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %s: %s", strings.Join(args, " "), err, strings.TrimSpace(errOut.String()))
+	}
+	return out, nil
+}
+
+// gitRoot returns the top directory of the git repository containing the working directory.
+func gitRoot() (string, error) {
+	out, err := git(".", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(strings.TrimSpace(string(out)))
+}
+
+// changedFiles returns the absolute paths of the files in the git repository containing the
+// working directory that differ from ref in the working tree or the index, along with any
+// untracked files that aren't ignored. If ref is empty, HEAD is used. If the repository has
+// no commits yet, every file in it counts as changed.
+func changedFiles(ref string) (map[string]bool, error) {
+	root, err := gitRoot()
+	if err != nil {
+		return nil, err
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	queries := [][]string{
+		{"ls-files", "-z", "--others", "--exclude-standard"},
+	}
+	if _, err := git(root, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err == nil {
+		queries = append(queries,
+			[]string{"diff", "-z", "--name-only", ref, "--"},
+			[]string{"diff", "-z", "--name-only", "--cached", ref, "--"})
+	} else if ref == "HEAD" {
+		// no commits yet
+		queries = append(queries, []string{"ls-files", "-z", "--cached"})
+	} else {
+		return nil, fmt.Errorf("Unknown git revision '%s'", ref)
+	}
+
+	changed := map[string]bool{}
+	for _, q := range queries {
+		out, err := git(root, q...)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range strings.Split(string(out), "\x00") {
+			if name != "" {
+				changed[filepath.Join(root, filepath.FromSlash(name))] = true
+			}
+		}
+	}
+	return changed, nil
+}
+
+// filterChanged returns the processors whose files have changed relative to the git ref,
+// or whose blocks depend on files that have.
+func filterChanged(procs []*processor.Processor, ref string) ([]*processor.Processor, error) {
+	changed, err := changedFiles(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := procs[:0]
+	for _, p := range procs {
+		ok, err := isChanged(p, changed)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			kept = append(kept, p)
+		} else {
+			slog.Debug("Skipping unchanged file", "file", p.File)
+		}
+	}
+	return kept, nil
+}
+
+// isChanged reports whether the processor's file, or any file its blocks depend on, is in the changed set.
+func isChanged(p *processor.Processor, changed map[string]bool) (bool, error) {
+	abs, err := filepath.Abs(p.File)
+	if err != nil {
+		return false, err
+	}
+	if changed[abs] {
+		return true, nil
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil && changed[real] {
+		return true, nil
+	}
+
+	deps, err := p.Dependencies()
+	if err != nil {
+		return false, err
+	}
+	for _, dep := range deps {
+		// the repository root git reports has its symlinks resolved
+		if dir, err := filepath.EvalSymlinks(filepath.Dir(dep)); err == nil {
+			dep = filepath.Join(dir, filepath.Base(dep))
+		}
+		if changed[filepath.Clean(dep)] {
+			return true, nil
+		}
+		for name := range changed {
+			if ok, _ := filepath.Match(dep, name); ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
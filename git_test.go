@@ -0,0 +1,113 @@
+package main
+
+import (
+	"github.com/natefinch/gocog/processor"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// newGitRepo makes a git repository in a new temporary directory holding the given files,
+// all committed, and makes it the working directory. The returned func undoes both.
+func newGitRepo(t *testing.T, files map[string]string) (string, func()) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+	if err := os.Chdir(dir); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, files)
+	runGit(t, "init", "-q")
+	commitAll(t, "initial")
+	return dir, cleanup
+}
+
+// commitAll commits every file in the working directory.
+func commitAll(t *testing.T, msg string) {
+	runGit(t, "add", "-A")
+	runGit(t, "-c", "user.name=gocog", "-c", "user.email=gocog@example.com", "commit", "-q", "--allow-empty", "-m", msg)
+}
+
+// runGit runs git with the given args in the working directory, failing the test if it fails.
+func runGit(t *testing.T, args ...string) {
+	if _, err := git(".", args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testProcessors returns a processor with the default options for each of the named files.
+func testProcessors(names ...string) []*processor.Processor {
+	opts := defaultOptions()
+	procs := make([]*processor.Processor, 0, len(names))
+	for _, name := range names {
+		procs = append(procs, processor.New(name, opts.processorOptions()))
+	}
+	return procs
+}
+
+// processorFiles returns the files of the processors, in order.
+func processorFiles(procs []*processor.Processor) []string {
+	var files []string
+	for _, p := range procs {
+		files = append(files, p.File)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestFilterChanged(t *testing.T) {
+	_, cleanup := newGitRepo(t, map[string]string{
+		"modified.go":  "package foo\n",
+		"staged.go":    "package foo\n",
+		"unchanged.go": "package foo\n",
+		"depends.go":   "// [[[gocog depends: data/*.txt\n// gocog]]]\n// [[[end]]]\n",
+		"data/a.txt":   "a\n",
+	})
+	defer cleanup()
+
+	writeFiles(t, ".", map[string]string{
+		"modified.go":  "package bar\n",
+		"staged.go":    "package bar\n",
+		"untracked.go": "package foo\n",
+		"data/a.txt":   "b\n",
+	})
+	runGit(t, "add", "staged.go")
+
+	procs, err := filterChanged(testProcessors("depends.go", "modified.go", "staged.go", "unchanged.go", "untracked.go"), "")
+	if err != nil {
+		t.Fatalf("FilterChanged: unexpected error: %v", err)
+	}
+	if files, expected := processorFiles(procs), []string{"depends.go", "modified.go", "staged.go", "untracked.go"}; !reflect.DeepEqual(files, expected) {
+		t.Errorf("FilterChanged: Expected %q, Got %q", expected, files)
+	}
+
+	// with --since, files changed in commits since the ref count too
+	runGit(t, "tag", "before")
+	commitAll(t, "change")
+	if procs, err = filterChanged(testProcessors("modified.go", "unchanged.go"), ""); err != nil || len(procs) != 0 {
+		t.Errorf("FilterChanged: Expected nothing changed since the last commit, Got %q, %v", processorFiles(procs), err)
+	}
+	if procs, err = filterChanged(testProcessors("modified.go", "unchanged.go"), "before"); err != nil || !reflect.DeepEqual(processorFiles(procs), []string{"modified.go"}) {
+		t.Errorf("FilterChanged: Expected modified.go changed since the tag, Got %q, %v", processorFiles(procs), err)
+	}
+
+	if _, err := filterChanged(testProcessors("modified.go"), "nosuchref"); err == nil {
+		t.Error("FilterChanged: Expected an error for an unknown ref")
+	}
+}
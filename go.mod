@@ -0,0 +1,11 @@
+module github.com/natefinch/gocog
+
+go 1.26.0
+
+require (
+	github.com/jessevdk/go-flags v1.6.1
+	github.com/kballard/go-shellquote v0.0.0-20180428030007-95032a82bc51
+	golang.org/x/sys v0.48.0
+	golang.org/x/term v0.46.0
+	golang.org/x/text v0.40.0
+)
@@ -1,17 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/jessevdk/go-flags"
 	"github.com/kballard/go-shellquote"
 	"github.com/natefinch/gocog/processor"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
@@ -23,28 +27,38 @@ func init() {
 }
 
 func main() {
-	opts := processor.Options{
-		Command:   "go",
-		Args:      []string{"run", "%s"},
-		Ext:       ".go",
-		StartMark: "[[[",
-		EndMark:   "]]]",
-	}
-
-	p := flags.NewParser(&opts, flags.Default)
-	p.Usage = `[OPTIONS] [INFILE | @FILELIST] ...
+	// until a command sets it up as its options say, log as the commands do by default
+	slog.SetDefault(processor.NewLogger(os.Stderr, "", slog.LevelInfo))
 
-  Runs gocog over each infile. 
-  Strings prepended with @ are assumed to be files continaing newline delimited lists of gocog command lines.
-  Command line options are passed to each command line in the file list, but options on the file list line
-  will override command line options. You may have filelists specified inside filelist files.`
+	args := os.Args[1:]
+	// gocog FILE... is short for gocog run FILE...
+	if len(args) == 0 || (args[0] != "-h" && args[0] != "--help" && !isCommand(args[0])) {
+		args = append([]string{"run"}, args...)
+	}
 
-	remaining, err := p.ParseArgs(os.Args[1:])
-	if err != nil {
-		log.Println("Error parsing args:", err)
+	p := newParser(args)
+	if _, err := p.ParseArgs(args); err != nil {
+		if e, ok := err.(*flags.Error); ok && e.Type == flags.ErrHelp {
+			fmt.Println(e.Message)
+			os.Exit(0)
+		}
+		if err != errFailed {
+			slog.Error(err.Error())
+		}
+		if _, ok := err.(*usageError); ok {
+			p.WriteHelp(os.Stdout)
+		}
 		os.Exit(1)
 	}
+}
 
+// isCommand reports whether name is one of gocog's commands.
+func isCommand(name string) bool {
+	return newParser(nil).Find(name) != nil
+}
+
+// buildDate returns the date gocog was built, as set by running gocog over itself.
+func buildDate() string {
 	ver := ""
 	// [[[gocog
 	// package main
@@ -59,47 +73,375 @@ func main() {
 	// gocog]]]
 	ver = "20130206"
 	// [[[end]]]
+	return ver
+}
+
+// process runs a command that processes files. The mode args give the command its behavior,
+// and args is the rest of its command line.
+func process(mode, args []string) error {
+	opts, config, remaining, err := loadOptions(mode, args)
+	if err != nil {
+		return err
+	}
+	if err := setLogger(&opts.logOptions); err != nil {
+		return err
+	}
 	if opts.Version {
-		fmt.Printf(version, ver)
-		os.Exit(0)
+		fmt.Printf(version, buildDate())
+		return nil
+	}
+	if opts.Report != "" && reportFormats[opts.Report] == nil {
+		return &usageError{fmt.Errorf("Unknown report format '%s'", opts.Report)}
+	}
+	if opts.PreserveXattrs && !processor.XattrsSupported {
+		return &usageError{fmt.Errorf("--preserve-xattrs is not supported on %s", runtime.GOOS)}
 	}
 
-	if len(remaining) < 1 {
-		p.WriteHelp(os.Stdout)
-		os.Exit(1)
+	start := time.Now()
+	procs, err := findTargets(config, &opts, remaining, mode, args)
+	if err != nil {
+		return err
+	}
+	jobs := opts.Jobs
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
+	limit := processor.NewLimiter(jobs)
+	root := ""
+	if opts.DryRun || opts.Check {
+		root = diffRoot(config)
+	}
+	leftovers := &processor.Leftovers{}
+	for _, p := range procs {
+		p.Limit = limit
+		p.Root = root
+		p.Leftovers = leftovers
 	}
 
-	procs, err := handleCommandLine(os.Args[1:], opts)
+	workers := jobs
+	if opts.Serial {
+		workers = 1
+	}
+	prog := newProgress(procs, &opts)
+	errs := runAll(procs, workers, prog)
+	prog.Finish()
+
+	if opts.DryRun {
+		if err := writeDiffs(procs, opts.Patch); err != nil {
+			return fmt.Errorf("Error writing patch: %s", err)
+		}
+	}
+	if opts.Timings {
+		printTimings(os.Stderr, procs)
+	}
+	if opts.Trace != "" {
+		if err := writeTrace(opts.Trace, procs, errs, start); err != nil {
+			return fmt.Errorf("Error writing trace: %s", err)
+		}
+	}
+	if opts.Report != "" {
+		if err := writeReport(opts.Report, opts.ReportFile, newReport(procs, errs, time.Since(start))); err != nil {
+			return fmt.Errorf("Error writing report: %s", err)
+		}
+	}
+
+	failed := false
+	for _, err := range errs {
+		if err != nil && err != processor.NoCogCode {
+			failed = true
+		}
+	}
+	if opts.Check || opts.Staged {
+		if reportStale(procs, args, len(remaining) > 0) {
+			failed = true
+		}
+	}
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+// loadOptions parses the command line of a command that processes files, after loading the config
+// file it names or finds, and returns the options, the config, or nil if there isn't one, and the
+// targets named on the command line.
+func loadOptions(mode, args []string) (options, *projectConfig, []string, error) {
+	opts, remaining, err := parseOptions(mode, args)
 	if err != nil {
-		p.WriteHelp(os.Stdout)
-		os.Exit(1)
+		return opts, nil, nil, fmt.Errorf("Error parsing args: %s", err)
 	}
 
-	wg := &sync.WaitGroup{}
-	wg.Add(len(procs))
+	name := opts.Config
+	if name == "" && !opts.NoConfig {
+		if name, err = findConfig(); err != nil {
+			return opts, nil, nil, fmt.Errorf("Error finding config file: %s", err)
+		}
+	}
+	var config *projectConfig
+	if name != "" {
+		if config, err = loadConfig(name); err != nil {
+			return opts, nil, nil, err
+		}
+	}
+	// reparse so the command line overrides the config
+	base, err := config.base()
+	if err != nil {
+		return opts, nil, nil, fmt.Errorf("Error in config file '%s': %s", name, err)
+	}
+	if opts, _, err = parseOptions(append(base, mode, args)...); err != nil {
+		return opts, nil, nil, fmt.Errorf("Error parsing args: %s", err)
+	}
+	return opts, config, remaining, nil
+}
+
+// setLogger makes slog's default logger, which logs gocog's own messages, write to stderr
+// as the options say. Errors that stop gocog are still logged with the Quiet option.
+func setLogger(opts *logOptions) error {
+	if opts.LogFormat != "" && opts.LogFormat != "text" && opts.LogFormat != "json" {
+		return &usageError{fmt.Errorf("Unknown log format '%s', expected text or json", opts.LogFormat)}
+	}
+	switch opts.LogLevel {
+	case "", "debug", "info", "warn", "error":
+	default:
+		return &usageError{fmt.Errorf("Unknown log level '%s', expected debug, info, warn or error", opts.LogLevel)}
+	}
+	level := opts.level()
+	if opts.Quiet {
+		level = slog.LevelError
+	}
+	slog.SetDefault(processor.NewLogger(os.Stderr, opts.LogFormat, level))
+	return nil
+}
+
+// findTargets returns a processor for each file targeted by a command that processes files,
+// whether named on its command line, read from --files-from, staged in git or given by the config.
+func findTargets(config *projectConfig, opts *options, remaining, mode, args []string) ([]*processor.Processor, error) {
+	var err error
+	var names []string
+	if opts.FilesFrom != "" {
+		if names, err = readNames(opts.FilesFrom, opts.Null); err != nil {
+			return nil, fmt.Errorf("Error reading file names: %s", err)
+		}
+	}
+
+	var staged map[string]string
+	if opts.Staged {
+		if staged, err = stagedFiles(); err != nil {
+			return nil, fmt.Errorf("Error finding staged files: %s", err)
+		}
+		// with nothing else to go on, check everything that's staged
+		if len(remaining) < 1 && len(names) == 0 && len(config.targets()) == 0 {
+			if len(staged) == 0 {
+				return nil, nil
+			}
+			for name := range staged {
+				names = append(names, relative(name))
+			}
+			sort.Strings(names)
+		}
+	}
+
+	targets := append(mode[:len(mode):len(mode)], args...)
+	if len(remaining) < 1 && len(names) == 0 {
+		if len(config.targets()) == 0 {
+			return nil, &usageError{errors.New("No files targeted on command line")}
+		}
+		targets = append(targets, config.targets()...)
+	}
+
+	var procs []*processor.Processor
+	if len(remaining) > 0 || len(names) == 0 {
+		if procs, err = handleCommandLine(targets, source{config: config}); err != nil {
+			if _, ok := err.(*filelistError); !ok {
+				return nil, &usageError{err}
+			}
+			return nil, err
+		}
+	}
+	if len(names) > 0 {
+		more, err := handleNames(names, opts, source{layers: [][]string{targets}, config: config})
+		if err != nil {
+			return nil, err
+		}
+		procs = dedupe(append(procs, more...))
+	}
+
+	if opts.OnlyChanged || opts.Since != "" {
+		if procs, err = filterChanged(procs, opts.Since); err != nil {
+			return nil, fmt.Errorf("Error finding changed files: %s", err)
+		}
+	}
+	if opts.Staged {
+		if procs, err = filterStaged(procs, staged); err != nil {
+			return nil, fmt.Errorf("Error reading staged files: %s", err)
+		}
+	}
+
+	return procs, nil
+}
+
+// reportStale tells the user which files the processors found to be out of date and how to
+// regenerate them, and reports whether there were any. If hasTargets is false, the command line
+// didn't name any files, so the files are added to the suggested command.
+func reportStale(procs []*processor.Processor, args []string, hasTargets bool) bool {
+	var stale []string
 	for _, p := range procs {
-		if opts.Serial {
-			run(p, wg)
-		} else {
-			go run(p, wg)
+		if p.Changed {
+			stale = append(stale, p.File)
 		}
 	}
+	if len(stale) == 0 {
+		return false
+	}
+
+	// suggest the same command line, without the options that stop it from writing
+	cmd := []string{"gocog", "run"}
+	for _, arg := range args {
+		switch arg {
+		case "--check", "--staged", "-q", "--quiet":
+		default:
+			cmd = append(cmd, arg)
+		}
+	}
+	if !hasTargets {
+		cmd = append(cmd, stale...)
+	}
+
+	fmt.Fprintln(os.Stderr, "gocog: generated sections are out of date in:")
+	for _, name := range stale {
+		fmt.Fprintln(os.Stderr, "\t"+name)
+	}
+	fmt.Fprintln(os.Stderr, "Run this command to regenerate them, then stage the changes:")
+	fmt.Fprintln(os.Stderr, "\t"+shellquote.Join(cmd...))
+	return true
+}
+
+// writeDiffs writes out the diffs found by processors run with --dry-run, in order,
+// to the named patch file, or to stdout if name is empty.
+// The patch file is written even if there are no diffs.
+func writeDiffs(procs []*processor.Processor, name string) error {
+	b := &bytes.Buffer{}
+	for _, p := range procs {
+		b.Write(p.Diff)
+	}
+	if name != "" {
+		return ioutil.WriteFile(name, b.Bytes(), 0666)
+	}
+	_, err := b.WriteTo(os.Stdout)
+	return err
+}
+
+// diffRoot returns the directory that files are named relative to in diffs: the top of the git
+// repository, where git apply expects patches to start, or else the directory holding the config
+// file, or else the working directory, given as "".
+func diffRoot(config *projectConfig) string {
+	if root, err := gitRoot(); err == nil {
+		return root
+	}
+	if config != nil {
+		return config.dir
+	}
+	return ""
+}
+
+// runAll processes the given processors using at most workers goroutines at once, recording
+// each file done in the progress, and returns the error from each processor, in order.
+func runAll(procs []*processor.Processor, workers int, prog *progress) []error {
+	if workers > len(procs) {
+		workers = len(procs)
+	}
+	errs := make([]error, len(procs))
+	queue := make(chan int)
+	wg := &sync.WaitGroup{}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go run(procs, errs, queue, wg, prog)
+	}
+	for i := range procs {
+		queue <- i
+	}
+	close(queue)
 	wg.Wait()
+	return errs
 }
 
-// run initiates processing and then signals the waitgroup when finished
-func run(p *processor.Processor, wg *sync.WaitGroup) {
-	p.Run()
+// run processes each processor whose index is read from the queue, recording its error,
+// and then signals the waitgroup when the queue is closed
+func run(procs []*processor.Processor, errs []error, queue <-chan int, wg *sync.WaitGroup, prog *progress) {
+	for i := range queue {
+		errs[i] = procs[i].Run()
+		prog.Done(errs[i])
+	}
 	wg.Done()
 }
 
+// readNames reads the names of files to process from the named file, or stdin if name is -.
+// Names are separated by newlines, or by NUL characters if null is true. Empty names are ignored.
+func readNames(name string, null bool) ([]string, error) {
+	var b []byte
+	var err error
+	if name == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sep := "\n"
+	if null {
+		sep = "\x00"
+	}
+	var names []string
+	for _, s := range strings.Split(string(b), sep) {
+		if !null {
+			s = strings.TrimSuffix(s, "\r")
+		}
+		if s != "" {
+			names = append(names, s)
+		}
+	}
+	return names, nil
+}
+
+// parseOptions parses each set of args in turn over the default options, so later sets override
+// earlier ones, and returns the resulting options and the non-option arguments from the last set.
+func parseOptions(layers ...[]string) (options, []string, error) {
+	opts := defaultOptions()
+	var remaining []string
+	for _, args := range layers {
+		var err error
+		// errors are reported by the caller, which knows where the args came from
+		if remaining, err = flags.NewParser(&opts, flags.HelpFlag|flags.PassDoubleDash|flags.AllowBoolValues).ParseArgs(args); err != nil {
+			return opts, nil, err
+		}
+	}
+
+	if opts.ShowDiff {
+		opts.DryRun = true
+	}
+	if opts.Staged {
+		opts.Check = true
+	}
+
+	if len(opts.Ext) > 0 && opts.Ext[:1] != "." {
+		opts.Ext = "." + opts.Ext
+	}
+	return opts, remaining, nil
+}
+
 // handleCommandLine parses the args into options and creates Processors from the files and filelists.
+// src describes where the command line came from.
 // Will return an error if no files or filelists are on the command line.
 // args is expected not to contain the executable name.
-func handleCommandLine(args []string, opts processor.Options) ([]*processor.Processor, error) {
-	p := flags.NewParser(&opts, flags.Default)
-
-	remaining, err := p.ParseArgs(args)
+func handleCommandLine(args []string, src source) ([]*processor.Processor, error) {
+	src.layers = append(src.layers[:len(src.layers):len(src.layers)], args)
+	base, err := src.config.base()
+	if err != nil {
+		return nil, err
+	}
+	opts, remaining, err := parseOptions(append(base, src.layers...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -108,55 +450,93 @@ func handleCommandLine(args []string, opts processor.Options) ([]*processor.Proc
 		return nil, errors.New("No files targeted on command line")
 	}
 
-	if len(opts.Ext) > 0 && opts.Ext[:1] != "." {
-		opts.Ext = "." + opts.Ext
+	for i, name := range remaining {
+		// most likely a quoted variable that isn't set, which would otherwise name the directory
+		if name == "" || name == "@" {
+			return nil, errors.New("Empty file name")
+		}
+		remaining[i] = resolve(src.dir, name)
 	}
-
-	return handleRemaining(remaining, &opts)
+	return handleRemaining(remaining, &opts, src)
 }
 
-// handleRemaining creates processors from the files and filelists with the given options.
-func handleRemaining(names []string, opts *processor.Options) ([]*processor.Processor, error) {
+// handleRemaining creates processors from the files, directories, globs and filelists with the given options.
+// Each file's processor gets the options from the config for that file, overridden by the layers of args in src.
+func handleRemaining(names []string, opts *options, src source) ([]*processor.Processor, error) {
 	procs := make([]*processor.Processor, 0, len(names))
 	for _, s := range names {
 		if s[:1] == "@" {
-			p, err := handleFilelist(s[1:], opts)
+			p, err := handleFilelist(s[1:], opts, src)
 			if err != nil {
 				return nil, err
 			}
 			procs = append(procs, p...)
 		} else {
-			procs = append(procs, processor.New(s, opts))
+			files, err := expandTarget(s, opts)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range files {
+				p, err := newProcessor(f, opts, src)
+				if err != nil {
+					return nil, err
+				}
+				procs = append(procs, p)
+			}
 		}
 	}
-	return procs, nil
+	return dedupe(procs), nil
 }
 
-// handleFilelist reads the file given and handles each non-blank line as a command line for gocog.
-func handleFilelist(name string, opts *processor.Options) ([]*processor.Processor, error) {
-	if opts.Verbose {
-		log.Printf("Processing filelist '%s'", name)
-	}
-	b, err := ioutil.ReadFile(name)
-	if err != nil {
-		return nil, err
+// handleNames creates a processor for each of the named files, as handleRemaining does, but
+// takes each name literally. Names read with --files-from are exact file names, so they are not
+// expanded as globs or directories, and a leading @ is part of the name rather than a filelist.
+func handleNames(names []string, opts *options, src source) ([]*processor.Processor, error) {
+	procs := make([]*processor.Processor, 0, len(names))
+	for _, name := range names {
+		p, err := newProcessor(name, opts, src)
+		if err != nil {
+			return nil, err
+		}
+		procs = append(procs, p)
 	}
-	lines := strings.SplitAfter(string(b), "\n")
+	return dedupe(procs), nil
+}
 
-	procs := make([]*processor.Processor, 0, len(lines))
-	for i, line := range lines {
-		if len(line) == 0 {
-			continue
-		}
-		args, err := shellquote.Split(line)
+// newProcessor creates a processor for the named file. It gets the options from the config
+// for that file, overridden by the layers of args in src, or opts if there is no config.
+func newProcessor(name string, opts *options, src source) (*processor.Processor, error) {
+	fileOpts := *opts
+	if src.config != nil {
+		layers, err := src.config.argsFor(name)
 		if err != nil {
-			return nil, fmt.Errorf("Error parsing command line in filelist '%s' line %d", name, i+1)
+			return nil, fmt.Errorf("Error in config file for '%s': %s", name, err)
 		}
-		p, err := handleCommandLine(args, *opts)
-		if err != nil {
+		if fileOpts, _, err = parseOptions(append(layers, src.layers...)...); err != nil {
 			return nil, err
 		}
-		procs = append(procs, p...)
 	}
-	return procs, nil
+	p := processor.New(name, fileOpts.processorOptions())
+	p.Logger = processor.NewLogger(os.Stderr, fileOpts.LogFormat, p.LogLevel())
+	return p, nil
+}
+
+// dedupe removes processors whose file is already targeted by an earlier processor,
+// so each file is only processed once, with the options it was first given.
+func dedupe(procs []*processor.Processor) []*processor.Processor {
+	seen := make(map[string]bool, len(procs))
+	unique := procs[:0]
+	for _, p := range procs {
+		name, err := filepath.Abs(p.File)
+		if err != nil {
+			name = filepath.Clean(p.File)
+		}
+		if seen[name] {
+			slog.Info("Skipping duplicate target", "file", p.File)
+			continue
+		}
+		seen[name] = true
+		unique = append(unique, p)
+	}
+	return unique
 }
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/jessevdk/go-flags"
+	"github.com/natefinch/gocog/processor"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHandleNamesTakesNamesLiterally(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// each of these would be misread as a glob or a filelist, and a1.go matches the first glob
+	names := []string{"a[1].go", "x*.go", "@notes.go", "a1.go"}
+	for i, name := range names {
+		names[i] = filepath.Join(dir, name)
+		if err := ioutil.WriteFile(names[i], nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := defaultOptions()
+	procs, err := handleNames(names[:3], &opts, source{})
+	if err != nil {
+		t.Fatalf("HandleNames: unexpected error: %v", err)
+	}
+	if len(procs) != 3 {
+		t.Fatalf("HandleNames: Expected 3 processors, got %d", len(procs))
+	}
+	for i, p := range procs {
+		if p.File != names[i] {
+			t.Errorf("HandleNames Test %d: Expected file '%s', got '%s'", i, names[i], p.File)
+		}
+	}
+}
+
+type CommandOptionsData struct {
+	args []string
+	flag string
+}
+
+func TestCommandsRejectOtherOptions(t *testing.T) {
+	tests := []CommandOptionsData{
+		{[]string{"list", "--check", "foo.go"}, "check"},
+		{[]string{"list", "--report", "json", "foo.go"}, "report"},
+		{[]string{"vet", "--jobs", "4", "foo.go"}, "jobs"},
+		{[]string{"vet", "--cmd", "sh", "foo.go"}, "cmd"},
+		{[]string{"check", "--dry-run", "foo.go"}, "dry-run"},
+		{[]string{"diff", "--staged", "foo.go"}, "staged"},
+		{[]string{"excise", "--parallel", "foo.go"}, "parallel"},
+		{[]string{"run", "--format", "json", "foo.go"}, "format"},
+		{[]string{"version", "--quietly"}, "quietly"},
+	}
+	for i, test := range tests {
+		_, err := newParser(test.args).ParseArgs(test.args)
+		e, ok := err.(*flags.Error)
+		if !ok || e.Type != flags.ErrUnknownFlag || !strings.Contains(e.Message, test.flag) {
+			t.Errorf("CommandsRejectOtherOptions Test %d: Expected unknown flag %s, Got %v", i, test.flag, err)
+		}
+	}
+}
+
+func TestRunHidesOldFlags(t *testing.T) {
+	p := newParser(nil)
+	run := p.Find("run")
+	for _, name := range []string{"check", "staged", "dry-run", "diff", "patch", "excise", "version"} {
+		if run.FindOptionByLongName(name) == nil {
+			t.Errorf("RunHidesOldFlags: Expected run to accept --%s", name)
+		}
+	}
+	p.Active = run
+	b := &bytes.Buffer{}
+	p.WriteHelp(b)
+	for _, name := range []string{"--check", "--dry-run", "--excise", "--version", "--format"} {
+		if strings.Contains(b.String(), name) {
+			t.Errorf("RunHidesOldFlags: Expected %s to be left out of run's help, Got:\n%s", name, b)
+		}
+	}
+}
+
+// concurrencyWatcher records the most generators that were running at once.
+type concurrencyWatcher struct {
+	mu      sync.Mutex
+	running int
+	max     int
+}
+
+func (w *concurrencyWatcher) Started(file string, n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.running++
+	if w.running > w.max {
+		w.max = w.running
+	}
+}
+
+func (w *concurrencyWatcher) Finished(file string, n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.running--
+}
+
+type RunAllData struct {
+	workers  int
+	jobs     int
+	blocks   int
+	parallel bool
+	max      int
+}
+
+func TestRunAllLimitsConcurrency(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []RunAllData{
+		// with one block per file, the generators running are the files being processed
+		{3, 0, 1, false, 3},
+		{1, 0, 1, false, 1},
+		// the limit is shared by the files, and the blocks of each file run in parallel
+		{4, 2, 3, true, 2},
+		{2, 3, 3, true, 3},
+	}
+
+	const block = "[[[gocog\nsleep 0.05\ngocog]]]\n[[[end]]]\n"
+	for i, test := range tests {
+		w := &concurrencyWatcher{}
+		var limit processor.Limiter
+		if test.jobs > 0 {
+			limit = processor.NewLimiter(test.jobs)
+		}
+		var procs []*processor.Processor
+		for j := 0; j < 6; j++ {
+			name := filepath.Join(dir, fmt.Sprintf("%d_%d.txt", i, j))
+			if err := ioutil.WriteFile(name, []byte(strings.Repeat(block, test.blocks)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			p := processor.New(name, &processor.Options{Command: "sh", Args: []string{"%s"}, Ext: ".sh",
+				StartMark: "[[[", EndMark: "]]]", Parallel: test.parallel, Quiet: true})
+			p.Limit = limit
+			p.Watch = w
+			procs = append(procs, p)
+		}
+
+		for j, err := range runAll(procs, test.workers, nil) {
+			if err != nil {
+				t.Fatalf("RunAllLimitsConcurrency Test %d: unexpected error for file %d: %v", i, j, err)
+			}
+		}
+		if w.max > test.max {
+			t.Errorf("RunAllLimitsConcurrency Test %d: Expected at most %d generators at once, Got %d", i, test.max, w.max)
+		}
+		// the generators sleep long enough that some run at once when they're allowed to
+		if test.max > 1 && w.max < 2 {
+			t.Errorf("RunAllLimitsConcurrency Test %d: Expected generators to run at once, Got %d at most", i, w.max)
+		}
+	}
+}
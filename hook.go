@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"github.com/kballard/go-shellquote"
+	"github.com/natefinch/gocog/processor"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hookMarker identifies pre-commit hooks written by gocog, so they can be replaced without --force.
+const hookMarker = "# Installed by gocog hook install."
+
+// hookScript is the pre-commit hook, which checks the staged contents of the files being committed.
+const hookScript = `#!/bin/sh
+%s
+# Blocks the commit if the generated sections of any staged file are out of date.
+exec gocog check --staged --quiet%s
+`
+
+// installHook writes the pre-commit hook to the current git repository, passing it the given args.
+// An existing hook is only replaced if gocog wrote it, or force is true.
+func installHook(args []string, force bool) error {
+	out, err := git(".", "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return err
+	}
+	dir := strings.TrimSpace(string(out))
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	name := filepath.Join(dir, "pre-commit")
+
+	if b, err := ioutil.ReadFile(name); err == nil && !force && !strings.Contains(string(b), hookMarker) {
+		return fmt.Errorf("'%s' already exists, use --force to replace it", name)
+	}
+
+	extra := ""
+	if len(args) > 0 {
+		extra = " " + shellquote.Join(args...)
+	}
+	if err := ioutil.WriteFile(name, []byte(fmt.Sprintf(hookScript, hookMarker, extra)), 0777); err != nil {
+		return err
+	}
+	// WriteFile doesn't change the mode of an existing file
+	if err := os.Chmod(name, 0755); err != nil {
+		return err
+	}
+	slog.Info("Installed pre-commit hook", "hook", name)
+	return nil
+}
+
+// stagedFiles returns the files added, copied, modified or renamed in the git index,
+// mapping the absolute path of each to its path in the repository.
+func stagedFiles() (map[string]string, error) {
+	root, err := gitRoot()
+	if err != nil {
+		return nil, err
+	}
+	out, err := git(root, "diff", "-z", "--cached", "--name-only", "--diff-filter=ACMR")
+	if err != nil {
+		return nil, err
+	}
+	staged := map[string]string{}
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			staged[filepath.Join(root, filepath.FromSlash(name))] = name
+		}
+	}
+	return staged, nil
+}
+
+// filterStaged returns the processors whose files are staged, giving each the staged contents of its file as input.
+func filterStaged(procs []*processor.Processor, staged map[string]string) ([]*processor.Processor, error) {
+	root, err := gitRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	kept := procs[:0]
+	for _, p := range procs {
+		abs, err := filepath.Abs(p.File)
+		if err != nil {
+			return nil, err
+		}
+		path, ok := staged[abs]
+		if !ok {
+			if real, err := filepath.EvalSymlinks(abs); err == nil {
+				path, ok = staged[real]
+			}
+		}
+		if !ok {
+			slog.Debug("Skipping unstaged file", "file", p.File)
+			continue
+		}
+		if p.Input, err = git(root, "cat-file", "blob", ":"+path); err != nil {
+			return nil, err
+		}
+		kept = append(kept, p)
+	}
+	return kept, nil
+}
+
+// relative returns name relative to the working directory if it is below it.
+func relative(name string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return name
+	}
+	rel, err := filepath.Rel(wd, name)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return name
+	}
+	return rel
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInstallHook(t *testing.T) {
+	dir, cleanup := newGitRepo(t, nil)
+	defer cleanup()
+	hook := filepath.Join(dir, ".git", "hooks", "pre-commit")
+	writeFiles(t, dir, map[string]string{".git/hooks/pre-commit": "#!/bin/sh\nmake lint\n"})
+
+	if err := installHook(nil, false); err == nil {
+		t.Error("InstallHook: Expected an error replacing a hook gocog didn't write")
+	}
+	if b, err := ioutil.ReadFile(hook); err != nil || string(b) != "#!/bin/sh\nmake lint\n" {
+		t.Errorf("InstallHook: Expected the existing hook to be left alone, Got %q, %v", b, err)
+	}
+
+	if err := installHook(nil, true); err != nil {
+		t.Fatalf("InstallHook: unexpected error with force: %v", err)
+	}
+	// gocog's own hook is replaced without force
+	if err := installHook([]string{"--config", "my config.json"}, false); err != nil {
+		t.Fatalf("InstallHook: unexpected error replacing gocog's hook: %v", err)
+	}
+	b, err := ioutil.ReadFile(hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), hookMarker) || !strings.Contains(string(b), "exec gocog check --staged --quiet --config 'my config.json'\n") {
+		t.Errorf("InstallHook: Expected gocog's hook with the args, Got:\n%s", b)
+	}
+}
+
+func TestFilterStaged(t *testing.T) {
+	_, cleanup := newGitRepo(t, map[string]string{"a.go": "committed\n", "b.go": "committed\n"})
+	defer cleanup()
+
+	// the staged contents of a.go differ from the working tree, and b.go isn't staged at all
+	writeFiles(t, ".", map[string]string{"a.go": "staged\n", "b.go": "changed\n"})
+	runGit(t, "add", "a.go")
+	writeFiles(t, ".", map[string]string{"a.go": "worktree\n"})
+
+	staged, err := stagedFiles()
+	if err != nil {
+		t.Fatalf("StagedFiles: unexpected error: %v", err)
+	}
+	procs, err := filterStaged(testProcessors("a.go", "b.go"), staged)
+	if err != nil {
+		t.Fatalf("FilterStaged: unexpected error: %v", err)
+	}
+	if len(procs) != 1 || procs[0].File != "a.go" {
+		t.Fatalf("FilterStaged: Expected only a.go, Got %q", processorFiles(procs))
+	}
+	if string(procs[0].Input) != "staged\n" {
+		t.Errorf("FilterStaged: Expected the staged contents of a.go, Got %q", procs[0].Input)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// junitTestSuites is the root of a JUnit XML report.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite holds the test cases for a file.
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is a block in a file, or the file as a whole for problems that aren't in a single block.
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemErr *junitOutput  `xml:"system-err,omitempty"`
+}
+
+// junitFailure is a failure or error in a test case, with its details as the text.
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",cdata"`
+}
+
+// junitSkipped marks a test case that wasn't run.
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// junitOutput is output captured from a test case.
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+// staleMessage is the message of the failure for output that's out of date.
+const staleMessage = "generated output is out of date"
+
+// writeJUnitReport writes the report as JUnit XML, with a test suite for each file, and a test
+// case for each of its blocks. Generator failures and blocks whose output is out of date are
+// failures, carrying the generator's stderr or the hunks of the file's diff that change the block. Errors that aren't in a single
+// block are reported by an extra test case for the whole file, as are files with no gocog code,
+// which are skipped rather than failed.
+func writeJUnitReport(w io.Writer, r *runReport) error {
+	root := junitTestSuites{Name: "gocog", Time: seconds(r.Duration)}
+	for _, f := range r.Files {
+		suite := junitTestSuite{Name: f.File, Time: seconds(f.Duration)}
+		if f.Status == "no-cog-code" {
+			suite.add(junitTestCase{Name: "file", Classname: f.File, Time: seconds(f.Duration),
+				Skipped: &junitSkipped{"no gocog code"}})
+			root.add(suite)
+			continue
+		}
+		blockFailed, blockStale := false, false
+		for _, b := range f.Blocks {
+			c := junitTestCase{
+				Name:      fmt.Sprintf("block %d", b.Block),
+				Classname: f.File,
+				Time:      seconds(b.Duration),
+			}
+			if b.Stderr != "" {
+				c.SystemErr = &junitOutput{b.Stderr}
+			}
+			switch {
+			case b.Status == "failed":
+				c.Failure = &junitFailure{Message: b.Error, Type: "generator", Text: b.Stderr}
+				blockFailed = true
+			case f.Status == "stale" && b.Changed:
+				c.Failure = &junitFailure{Message: staleMessage, Type: "stale", Text: blockDiff(f.Diff, b.Line, b.EndLine)}
+				blockStale = true
+			}
+			suite.add(c)
+		}
+
+		c := junitTestCase{Name: "file", Classname: f.File, Time: seconds(f.Duration)}
+		switch {
+		case f.Status == "error" && !blockFailed:
+			c.Error = &junitFailure{Message: f.Error, Type: "error"}
+			suite.add(c)
+		case f.Status == "stale" && !blockStale:
+			c.Failure = &junitFailure{Message: staleMessage, Type: "stale", Text: f.Diff}
+			suite.add(c)
+		case len(f.Blocks) == 0:
+			suite.add(c)
+		}
+
+		root.add(suite)
+	}
+
+	b, err := xml.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, b)
+	return err
+}
+
+// blockDiff returns the header of a file's unified diff and its hunks that change the lines from
+// start to end of the original file, where an end of 0 is the end of the file. If the block's lines
+// aren't known, or none of the hunks change them, the whole diff is returned.
+func blockDiff(diff string, start, end int) string {
+	if start == 0 {
+		return diff
+	}
+	if end == 0 {
+		end = math.MaxInt32
+	}
+	b := &strings.Builder{}
+	keep, found := true, false
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if strings.HasPrefix(line, "@@ ") {
+			from, count := 0, 1
+			if n, _ := fmt.Sscanf(line, "@@ -%d,%d", &from, &count); n == 0 {
+				return diff
+			}
+			if count == 0 {
+				// a hunk that only adds lines adds them after line from
+				keep = from >= start && from < end
+			} else {
+				keep = from <= end && from+count-1 >= start
+			}
+			found = found || keep
+		}
+		if keep {
+			b.WriteString(line)
+		}
+	}
+	if !found {
+		return diff
+	}
+	return b.String()
+}
+
+// add adds the test suite to the report and counts its test cases.
+func (r *junitTestSuites) add(s junitTestSuite) {
+	r.Tests += s.Tests
+	r.Failures += s.Failures
+	r.Errors += s.Errors
+	r.Skipped += s.Skipped
+	r.Suites = append(r.Suites, s)
+}
+
+// add adds the test case to the suite and counts it.
+func (s *junitTestSuite) add(c junitTestCase) {
+	s.Tests++
+	if c.Failure != nil {
+		s.Failures++
+	}
+	if c.Error != nil {
+		s.Errors++
+	}
+	if c.Skipped != nil {
+		s.Skipped++
+	}
+	s.Cases = append(s.Cases, c)
+}
+
+// seconds formats a duration in seconds as JUnit reports expect.
+func seconds(s float64) string {
+	return fmt.Sprintf("%.3f", s)
+}
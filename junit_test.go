@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+)
+
+// testReport is a run report with a file of each status.
+var testReport = &runReport{
+	Duration: 1.5,
+	Files: []fileReport{
+		{File: "ok.go", Status: "updated", Changed: true, Duration: 0.5, Blocks: []blockReport{
+			{Block: 1, Status: "ok", Duration: 0.25, Command: []string{"go", "run", "x.go"}, Stderr: "note\n", Bytes: 6, Changed: true},
+		}},
+		{File: "stale.go", Status: "stale", Changed: true, Duration: 0.5, Diff: "--- a/stale.go\n+++ b/stale.go\n", Blocks: []blockReport{
+			{Block: 1, Status: "ok", Duration: 0.125, Changed: false},
+			{Block: 2, Status: "ok", Duration: 0.125, Changed: true},
+		}, Findings: []finding{
+			{Rule: "stale-output", Level: "error", Message: "The generated output of block 2 is out of date", Line: 7, EndLine: 10},
+		}},
+		{File: "failed.go", Status: "error", Duration: 0.25, Error: "Error generating code", Blocks: []blockReport{
+			{Block: 1, Status: "failed", Duration: 0.25, ExitCode: 3, Stderr: "oops\n", Error: "Error generating code"},
+		}},
+		{File: "broken.go", Status: "error", Duration: 0.001, Error: "missing end marker", Blocks: []blockReport{}, Findings: []finding{
+			{Rule: "missing-end", Level: "error", Message: "Block 1 has no end marker", Line: 2, EndLine: 2},
+			{Rule: "stray-end", Level: "warning", Message: "End marker outside any block", Line: 5, Column: 4, EndLine: 5},
+		}},
+		{File: "none.go", Status: "no-cog-code", Duration: 0.001, Blocks: []blockReport{}},
+	},
+}
+
+const junitGolden = `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="gocog" tests="6" failures="2" errors="1" skipped="1" time="1.500">
+  <testsuite name="ok.go" tests="1" failures="0" errors="0" skipped="0" time="0.500">
+    <testcase name="block 1" classname="ok.go" time="0.250">
+      <system-err><![CDATA[note
+]]></system-err>
+    </testcase>
+  </testsuite>
+  <testsuite name="stale.go" tests="2" failures="1" errors="0" skipped="0" time="0.500">
+    <testcase name="block 1" classname="stale.go" time="0.125"></testcase>
+    <testcase name="block 2" classname="stale.go" time="0.125">
+      <failure message="generated output is out of date" type="stale"><![CDATA[--- a/stale.go
++++ b/stale.go
+]]></failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="failed.go" tests="1" failures="1" errors="0" skipped="0" time="0.250">
+    <testcase name="block 1" classname="failed.go" time="0.250">
+      <failure message="Error generating code" type="generator"><![CDATA[oops
+]]></failure>
+      <system-err><![CDATA[oops
+]]></system-err>
+    </testcase>
+  </testsuite>
+  <testsuite name="broken.go" tests="1" failures="0" errors="1" skipped="0" time="0.001">
+    <testcase name="file" classname="broken.go" time="0.001">
+      <error message="missing end marker" type="error"></error>
+    </testcase>
+  </testsuite>
+  <testsuite name="none.go" tests="1" failures="0" errors="0" skipped="1" time="0.001">
+    <testcase name="file" classname="none.go" time="0.001">
+      <skipped message="no gocog code"></skipped>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+
+func TestWriteJUnitReport(t *testing.T) {
+	b := &bytes.Buffer{}
+	if err := writeJUnitReport(b, testReport); err != nil {
+		t.Fatalf("WriteJUnitReport: unexpected error: %v", err)
+	}
+	if b.String() != junitGolden {
+		t.Errorf("WriteJUnitReport: Expected:\n%s\nGot:\n%s", junitGolden, b)
+	}
+
+	var back junitTestSuites
+	if err := xml.Unmarshal(b.Bytes(), &back); err != nil {
+		t.Fatalf("WriteJUnitReport: report is not valid XML: %v", err)
+	}
+	if len(back.Suites) != len(testReport.Files) {
+		t.Fatalf("WriteJUnitReport: Expected %d suites, Got %d", len(testReport.Files), len(back.Suites))
+	}
+	// files with no gocog code are skipped, not failed
+	none := back.Suites[4].Cases[0]
+	if none.Skipped == nil || none.Failure != nil || none.Error != nil {
+		t.Errorf("WriteJUnitReport: Expected a file with no gocog code to be skipped, Got %+v", none)
+	}
+	if failed := back.Suites[2].Cases[0]; failed.Failure == nil || failed.Failure.Type != "generator" || failed.Failure.Text != "oops\n" {
+		t.Errorf("WriteJUnitReport: Expected a failed generator to be a failure carrying its stderr, Got %+v", failed)
+	}
+}
+
+type BlockDiffData struct {
+	start, end int
+	diff       string
+}
+
+func TestBlockDiff(t *testing.T) {
+	header := "--- a/a.go\n+++ b/a.go\n"
+	first := "@@ -2,3 +2,3 @@\n a\n-b\n+B\n c\n"
+	second := "@@ -10,3 +10,4 @@\n j\n k\n+K\n l\n"
+	added := "@@ -20,0 +21,1 @@\n+u\n"
+	diff := header + first + second + added
+
+	tests := []BlockDiffData{
+		{1, 5, header + first},
+		{9, 12, header + second},
+		{4, 11, header + first + second},
+		{19, 21, header + added},
+		// the hunk adds lines after line 20, so after the end marker of a block ending there
+		{15, 20, diff},
+		{18, 0, header + added},
+		// unknown lines, or no hunk in the block
+		{0, 0, diff},
+		{6, 8, diff},
+	}
+
+	for i, test := range tests {
+		if got := blockDiff(diff, test.start, test.end); got != test.diff {
+			t.Errorf("BlockDiff Test %d: Expected:\n%s\nGot:\n%s", i, test.diff, got)
+		}
+	}
+	if got := blockDiff("", 1, 2); got != "" {
+		t.Errorf("BlockDiff: Expected nothing from an empty diff, Got %q", got)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kballard/go-shellquote"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// listedBlock is a block found by gocog list, along with the file it's in
+// and the options that would be used to run it.
+type listedBlock struct {
+	File    string `json:"file"`
+	Block   int    `json:"block"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	Command string `json:"command"`
+	Ext     string `json:"ext"`
+	Prefix  string `json:"prefix"`
+	Code    int    `json:"code"`
+	Output  int    `json:"output"`
+}
+
+// listBlocks runs gocog list, printing the blocks in each targeted file without running them.
+func listBlocks(mode, args []string) error {
+	opts, config, remaining, err := loadOptions(mode, args)
+	if err != nil {
+		return err
+	}
+	if err := setLogger(&opts.logOptions); err != nil {
+		return err
+	}
+	if opts.Format == "" {
+		opts.Format = "table"
+	}
+	if opts.Format != "table" && opts.Format != "json" {
+		return &usageError{fmt.Errorf("Unknown format '%s', expected table or json", opts.Format)}
+	}
+
+	procs, err := findTargets(config, &opts, remaining, mode, args)
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	listed := []listedBlock{}
+	for _, p := range procs {
+		blocks, err := p.Blocks()
+		if err != nil {
+			slog.Error("Error listing blocks", "file", p.File, "err", err)
+			failed = true
+			continue
+		}
+		cmd := shellquote.Join(append([]string{p.Command}, p.Args...)...)
+		for _, b := range blocks {
+			listed = append(listed, listedBlock{
+				File:    p.File,
+				Block:   b.N,
+				Start:   b.Start,
+				End:     b.End,
+				Command: cmd,
+				Ext:     p.Ext,
+				Prefix:  strings.TrimSpace(b.Prefix),
+				Code:    b.Code,
+				Output:  b.Output,
+			})
+		}
+	}
+
+	if opts.Format == "json" {
+		b, err := json.MarshalIndent(listed, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", b)
+	} else {
+		writeBlockTable(listed)
+	}
+
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+// writeBlockTable prints the blocks to stdout as a table, one block per line.
+// Blocks that run to the end of the file are shown as ending at EOF.
+func writeBlockTable(blocks []listedBlock) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tBLOCK\tLINES\tCOMMAND\tEXT\tPREFIX\tCODE\tOUTPUT")
+	for _, b := range blocks {
+		end := "EOF"
+		if b.End > 0 {
+			end = fmt.Sprint(b.End)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d-%s\t%s\t%s\t%s\t%d\t%d\n", b.File, b.Block, b.Start, end, b.Command, b.Ext, b.Prefix, b.Code, b.Output)
+	}
+	w.Flush()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"a.txt": "text\n" +
+			"# [[[gocog\n# echo one\n# gocog]]]\none\n# [[[end]]]\n" +
+			"// [[[gocog\n// echo two\n// echo three\n// gocog]]]\n// [[[end]]]\n",
+		"b.txt": "[[[gocog\necho eof\ngocog]]]\neof\nmore\n",
+	})
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	list := func(args ...string) (string, error) {
+		return captureStdout(t, func() error {
+			return listBlocks(nil, append([]string{"--no-config", "-q", "--eof", "--cmd", "sh", "--args", "%s", "--ext", ".sh"}, args...))
+		})
+	}
+
+	out, err := list("--format=json", a, b)
+	if err != nil {
+		t.Fatalf("ListBlocks: unexpected error: %v", err)
+	}
+	var listed []listedBlock
+	if err := json.Unmarshal([]byte(out), &listed); err != nil {
+		t.Fatalf("ListBlocks: Expected JSON, Got error %v:\n%s", err, out)
+	}
+	expected := []listedBlock{
+		{File: a, Block: 1, Start: 2, End: 6, Command: "sh %s", Ext: ".sh", Prefix: "#", Code: 11, Output: 4},
+		{File: a, Block: 2, Start: 7, End: 11, Command: "sh %s", Ext: ".sh", Prefix: "//", Code: 26, Output: 0},
+		// the block runs to the end of the file
+		{File: b, Block: 1, Start: 1, End: 0, Command: "sh %s", Ext: ".sh", Prefix: "", Code: 9, Output: 9},
+	}
+	if !reflect.DeepEqual(listed, expected) {
+		t.Errorf("ListBlocks: Expected %+v, Got %+v", expected, listed)
+	}
+
+	out, err = list(a, b)
+	if err != nil {
+		t.Fatalf("ListBlocks: unexpected error: %v", err)
+	}
+	pad := func(file string) string { return file + strings.Repeat(" ", len(b)-len(file)) }
+	table := "FILE" + strings.Repeat(" ", len(a)-len("FILE")) + "  BLOCK  LINES  COMMAND  EXT  PREFIX  CODE  OUTPUT\n" +
+		pad(a) + "  1      2-6    sh %s    .sh  #       11    4\n" +
+		pad(a) + "  2      7-11   sh %s    .sh  //      26    0\n" +
+		pad(b) + "  1      1-EOF  sh %s    .sh          9     9\n"
+	if out != table {
+		t.Errorf("ListBlocks: Expected table:\n%s\nGot:\n%s", table, out)
+	}
+}
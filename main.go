@@ -9,7 +9,7 @@ func main() {
   fmt.Println("")
   fmt.Print("/", "*", "\n")
   fmt.Println("Package main creates an executable that will generate text from inline sourcecode.\n")
-  cmd := exec.Command("gocog")
+  cmd := exec.Command("gocog", "--help")
   cmd.Stdout = os.Stdout
   cmd.Run()
   fmt.Print("*","/", "\n")
@@ -21,29 +21,25 @@ gocog]]] */
 Package main creates an executable that will generate text from inline sourcecode.
 
 Usage:
-  gocog [OPTIONS] [INFILE | @FILELIST] ...
+  gocog [OPTIONS] <command>
 
-  Runs gocog over each infile. 
-  Strings prepended with @ are assumed to be files continaing newline delimited lists of gocog command lines.
-  Command line options are passed to each command line in the file list, but options on the file list line
-  will override command line options. You may have filelists specified inside filelist files.
+Generates text from sourcecode inlined in files. gocog [OPTIONS] [INFILE | DIR
+| GLOB | @FILELIST] ... is short for gocog run with the same arguments. Use
+gocog COMMAND --help for the options of each command.
 
 Help Options:
-  -h, --help         Show this help message
+  -h, --help  Show this help message
+
+Available commands:
+  check    Report files whose generated output is out of date
+  clean    Remove temporary files left by interrupted runs
+  diff     Print the changes the generators would make
+  excise   Remove the generated output without running the generators
+  hook     Manage the git pre-commit hook
+  list     List the gocog blocks in files without running them
+  run      Run the generators and write their output (the default)
+  version  Display the version of gocog
+  vet      Report malformed or suspicious blocks without running them
 
-Application Options:
-  -z, --eof          The end marker can be assumed at eof.
-  -v, --verbose      enables verbose output
-  -q, --quiet        turns off all output
-  -S, --serial       Write to the specified cog files serially
-  -c, --cmd          The command used to run the generator code (go)
-  -a, --args         Comma separated arguments to cmd, %s for the code file
-                     ([run, %s])
-  -e, --ext          Extension to append to the generator filename (.go)
-  -M, --startmark    String that starts gocog statements ([[[)
-  -E, --endmark      String that ends gocog statements (]]])
-  -x, --excise       Excise all the generated output without running the
-                     generators.
-  -V, --version      Display the version of gocog
 */
 package main
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"github.com/natefinch/gocog/processor"
+	"log/slog"
+)
+
+// options are the options of the commands that process files. They come in groups, so that
+// each command only accepts the groups that make sense for it, but every command line is parsed
+// into the whole set, as are the options in the config and on the lines of filelists.
+type options struct {
+	logOptions
+	blockOptions
+	generatorOptions
+	jobOptions
+	execOptions
+	writeOptions
+	searchOptions
+	reportOptions
+	configOptions
+	checkOptions
+	diffOptions
+	formatOptions
+	modeOptions
+}
+
+// logOptions choose what gocog logs, and how.
+type logOptions struct {
+	Verbose   bool   `short:"v" long:"verbose" description:"enables verbose output"`
+	Quiet     bool   `short:"q" long:"quiet" description:"turns off all output"`
+	LogLevel  string `long:"log-level" description:"Lowest level of the messages logged: debug, info, warn or error (overrides --verbose)"`
+	LogFormat string `long:"log-format" description:"Format of the log written to stderr: text or json"`
+}
+
+// level returns the lowest level of the messages logged with the options.
+func (o *logOptions) level() slog.Level {
+	return (&processor.Options{Level: o.LogLevel, Verbose: o.Verbose, Quiet: o.Quiet}).LogLevel()
+}
+
+// blockOptions say how to find the gocog blocks in a file.
+type blockOptions struct {
+	UseEOF    bool   `short:"z" long:"eof" description:"The end marker can be assumed at eof."`
+	StartMark string `short:"M" long:"startmark" description:"String that starts gocog statements"`
+	EndMark   string `short:"E" long:"endmark" description:"String that ends gocog statements"`
+}
+
+// generatorOptions say how to run the generator code of a block.
+type generatorOptions struct {
+	Command string   `short:"c" long:"cmd" description:"The command used to run the generator code"`
+	Args    []string `short:"a" long:"args" description:"Comma separated arguments to cmd, %s for the code file"`
+	Ext     string   `short:"e" long:"ext" description:"Extension to append to the generator filename"`
+}
+
+// jobOptions say how many files are processed at once, and how their progress is shown.
+type jobOptions struct {
+	Serial     bool `short:"S" long:"serial" description:"Write to the specified cog files serially"`
+	Jobs       int  `short:"j" long:"jobs" description:"Maximum number of files and generators processed at once (defaults to the number of CPUs)"`
+	NoProgress bool `long:"no-progress" description:"Log each file instead of showing progress when stdout is a terminal"`
+}
+
+// execOptions say how the generators are run, and how their running is recorded.
+type execOptions struct {
+	Parallel     bool   `short:"P" long:"parallel" description:"Run the generators within each file concurrently"`
+	StreamStderr bool   `long:"stream-stderr" description:"Write each line generators write to stderr as soon as it's written, instead of when they exit"`
+	Timings      bool   `long:"timings" description:"Print the slowest blocks to stderr, and how long each step of generating them took"`
+	Trace        string `long:"trace" description:"Write a Chrome trace of the run to this file, for chrome://tracing or Perfetto"`
+}
+
+// writeOptions say what regenerated files keep from the original.
+type writeOptions struct {
+	PreserveOwner  bool `long:"preserve-owner" description:"Give regenerated files the owner and group of the original"`
+	PreserveXattrs bool `long:"preserve-xattrs" description:"Copy the extended attributes of the original to regenerated files"`
+}
+
+// searchOptions choose the files that are processed.
+type searchOptions struct {
+	Include     []string `short:"i" long:"include" description:"When searching directories, only process files matching this glob"`
+	Exclude     []string `short:"X" long:"exclude" description:"When searching directories, skip files and directories matching this glob"`
+	GitIgnore   bool     `long:"gitignore" description:"When searching directories, skip files ignored by git"`
+	FilesFrom   string   `long:"files-from" description:"Also process the files named in this file, one per line, or - for stdin"`
+	Null        bool     `short:"0" long:"null" description:"Names read by --files-from are separated by NUL characters instead of newlines"`
+	OnlyChanged bool     `long:"changed" description:"Only process files changed in git, or whose blocks depend on changed files"`
+	Since       string   `long:"since" description:"Only process files changed in git since this ref, or whose blocks depend on them (implies --changed)"`
+}
+
+// reportOptions ask for a report of the run.
+type reportOptions struct {
+	Report     string `long:"report" description:"Write a report of the run in this format: json, junit or sarif"`
+	ReportFile string `long:"report-file" description:"Write the report to this file instead of stdout"`
+}
+
+// configOptions choose the config file.
+type configOptions struct {
+	Config   string `long:"config" description:"Read default options from this config file instead of searching for .gocog.json"`
+	NoConfig bool   `long:"no-config" description:"Don't read a config file"`
+}
+
+// checkOptions are the options of gocog check.
+type checkOptions struct {
+	Staged bool `long:"staged" description:"Only process files staged in git, checking their staged contents (implies --check)"`
+}
+
+// diffOptions are the options of gocog diff.
+type diffOptions struct {
+	Patch string `long:"patch" description:"With --dry-run, write the diffs to this file as a single patch instead of printing them"`
+}
+
+// formatOptions choose the output format of gocog list and gocog vet.
+type formatOptions struct {
+	Format string `long:"format" description:"Output format of gocog list, table or json, and of gocog vet, text, json or sarif"`
+}
+
+// modeOptions are gocog run's flags for what are now commands of their own.
+// They're still accepted, so older command lines keep working.
+type modeOptions struct {
+	Check    bool `long:"check" description:"Run the generators and report files whose generated output is out of date, without writing anything"`
+	DryRun   bool `short:"n" long:"dry-run" description:"Run the generators and print a unified diff of the changes instead of writing them"`
+	ShowDiff bool `long:"diff" description:"Same as --dry-run"`
+	Excise   bool `short:"x" long:"excise" description:"Excise all the generated output without running the generators."`
+	Version  bool `short:"V" long:"version" description:"Display the version of gocog"`
+}
+
+// groups returns the option groups a command may accept, by their heading in its help.
+func (o *options) groups() map[string]interface{} {
+	return map[string]interface{}{
+		"Logging Options":   &o.logOptions,
+		"Block Options":     &o.blockOptions,
+		"Generator Options": &o.generatorOptions,
+		"Job Options":       &o.jobOptions,
+		"Execution Options": &o.execOptions,
+		"Write Options":     &o.writeOptions,
+		"Search Options":    &o.searchOptions,
+		"Report Options":    &o.reportOptions,
+		"Config Options":    &o.configOptions,
+		"Check Options":     &o.checkOptions,
+		"Diff Options":      &o.diffOptions,
+		"Format Options":    &o.formatOptions,
+		"Mode Options":      &o.modeOptions,
+	}
+}
+
+// processorOptions returns the options the processor of each file uses.
+func (o *options) processorOptions() *processor.Options {
+	return &processor.Options{
+		UseEOF:         o.UseEOF,
+		Level:          o.LogLevel,
+		Verbose:        o.Verbose,
+		Quiet:          o.Quiet,
+		Parallel:       o.Parallel,
+		StreamStderr:   o.StreamStderr,
+		Command:        o.Command,
+		Args:           o.Args,
+		Ext:            o.Ext,
+		StartMark:      o.StartMark,
+		EndMark:        o.EndMark,
+		DryRun:         o.DryRun,
+		Check:          o.Check,
+		Excise:         o.Excise,
+		PreserveOwner:  o.PreserveOwner,
+		PreserveXattrs: o.PreserveXattrs,
+	}
+}
+
+// defaultOptions returns the options used for anything not set by the config or the command line.
+func defaultOptions() options {
+	return options{
+		generatorOptions: generatorOptions{
+			Command: "go",
+			Args:    []string{"run", "%s"},
+			Ext:     ".go",
+		},
+		blockOptions: blockOptions{
+			StartMark: "[[[",
+			EndMark:   "]]]",
+		},
+	}
+}
@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// Block describes a gocog block in a file, as found by Blocks.
+type Block struct {
+	// N is the number of the block in the file, counting from 1.
+	N int
+	// Start is the line of the block's start mark, and End the line of its end mark,
+	// or 0 if the block runs to the end of the file.
+	Start int
+	End   int
+	// Prefix is the text before the start mark, which is removed from each line of generator code.
+	Prefix string
+	// Code is the size in bytes of the generator code, and Output the size of the
+	// generated output currently in the file.
+	Code   int
+	Output int
+}
+
+// Blocks returns the gocog blocks in the file, using the same parsing as Run,
+// but without running the generators or writing anything.
+func (p *Processor) Blocks() ([]Block, error) {
+	in, err := p.open()
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(in)
+	in.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	br := bytes.NewReader(b)
+	r := bufio.NewReader(br)
+	// offset is the number of bytes of the file consumed so far, and line the number of the
+	// line holding the last byte consumed
+	offset := func() int { return len(b) - br.Len() - r.Buffered() }
+	line := func() int { return bytes.Count(b[:offset()-1], []byte{newline}) + 1 }
+
+	var blocks []Block
+	for n := 1; ; n++ {
+		prefix, err := p.cogPlainText(r, ioutil.Discard, n == 1)
+		if err == NoCogCode || err == io.EOF {
+			return blocks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		block := Block{N: n, Start: line(), Prefix: prefix}
+
+		code, err := p.cogGeneratorCode(r, ioutil.Discard)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range code[:len(code)-1] {
+			block.Code += len(l)
+		}
+
+		end := &bytes.Buffer{}
+		old, err := p.cogToEnd(r, end)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if end.Len() > 0 {
+			block.End = line()
+		}
+		block.Output = len(old)
+		blocks = append(blocks, block)
+		if err == io.EOF {
+			return blocks, nil
+		}
+	}
+}
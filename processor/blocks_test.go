@@ -0,0 +1,55 @@
+package processor
+
+import (
+	"reflect"
+	"testing"
+)
+
+type BlocksData struct {
+	input  string
+	eof    bool
+	blocks []Block
+	err    bool
+}
+
+func TestBlocks(t *testing.T) {
+	tests := []BlocksData{
+		{"no cog code\n", false, nil, false},
+		{
+			"a\n// [[[gocog\n// code\n// gocog]]]\nout\nput\n// [[[end]]]\nb\n",
+			false,
+			[]Block{{N: 1, Start: 2, End: 7, Prefix: "// ", Code: 8, Output: 8}},
+			false,
+		},
+		{
+			"[[[gocog\ngocog]]]\n[[[end]]]\n# [[[gocog\n# x\n# y\n# gocog]]]\nz\n# [[[end]]]",
+			false,
+			[]Block{
+				{N: 1, Start: 1, End: 3, Prefix: "", Code: 0, Output: 0},
+				{N: 2, Start: 4, End: 9, Prefix: "# ", Code: 8, Output: 2},
+			},
+			false,
+		},
+		{
+			"// [[[gocog\n// code\n// gocog]]]\nout\n",
+			true,
+			[]Block{{N: 1, Start: 1, End: 0, Prefix: "// ", Code: 8, Output: 4}},
+			false,
+		},
+		{"// [[[gocog\n// code\n// gocog]]]\nout\n", false, nil, true},
+		{"// [[[gocog\n// code\n", false, nil, true},
+	}
+
+	for i, test := range tests {
+		p := New("foo.txt", &Options{StartMark: "[[[", EndMark: "]]]", UseEOF: test.eof, Quiet: true})
+		p.Input = []byte(test.input)
+		blocks, err := p.Blocks()
+		if (err != nil) != test.err {
+			t.Errorf("Blocks Test %d: Expected error %v, Got %v", i, test.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(blocks, test.blocks) {
+			t.Errorf("Blocks Test %d: Expected %+v, Got %+v", i, test.blocks, blocks)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dependsTag introduces the list of files a block depends on, on the same line as its start mark:
+//
+//	// [[[gocog depends: schema.sql templates/*.tmpl
+//
+// Paths are relative to the directory of the file containing the block, and may be globs.
+const dependsTag = "depends:"
+
+// Dependencies returns the files that the blocks in the file declare they depend on, as
+// absolute paths or glob patterns. A file that depends on a changed file needs regenerating
+// even if it hasn't changed itself.
+func (p *Processor) Dependencies() ([]string, error) {
+	f, err := os.Open(p.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dir, err := filepath.Abs(filepath.Dir(p.File))
+	if err != nil {
+		return nil, err
+	}
+
+	var deps []string
+	mark := p.StartMark + "gocog"
+	r := bufio.NewReader(f)
+	for {
+		line, found, err := findLine(r, mark)
+		if found {
+			for _, d := range parseDepends(line, mark) {
+				if !filepath.IsAbs(d) {
+					d = filepath.Join(dir, filepath.FromSlash(d))
+				}
+				deps = append(deps, d)
+			}
+		}
+		if err == io.EOF {
+			return deps, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseDepends returns the paths listed after the depends tag following the mark in line.
+func parseDepends(line, mark string) []string {
+	i := strings.Index(line, mark)
+	if i < 0 {
+		return nil
+	}
+	rest := strings.TrimSpace(line[i+len(mark):])
+	if !strings.HasPrefix(rest, dependsTag) {
+		return nil
+	}
+	return strings.Fields(rest[len(dependsTag):])
+}
@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type DependsData struct {
+	line string
+	deps []string
+}
+
+func TestParseDepends(t *testing.T) {
+	tests := []DependsData{
+		{"// [[[gocog\n", nil},
+		{"// [[[gocog  stuff\n", nil},
+		{"// [[[gocog depends: a.txt\n", []string{"a.txt"}},
+		{"# [[[gocog depends:a.txt  ../b/*.json\r\n", []string{"a.txt", "../b/*.json"}},
+		{"[[[gocog depends:\n", []string{}},
+		{"depends: a.txt\n", nil},
+	}
+
+	for i, test := range tests {
+		deps := parseDepends(test.line, "[[[gocog")
+		if len(deps) != len(test.deps) || (len(deps) > 0 && !reflect.DeepEqual(deps, test.deps)) {
+			t.Errorf("ParseDepends Test %d: Expected %q, got %q", i, test.deps, deps)
+		}
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "foo.txt")
+	input := "// [[[gocog depends: schema.sql\n// gocog]]]\n// [[[end]]]\n" +
+		"// [[[gocog\n// gocog]]]\n// [[[end]]]\n" +
+		"// [[[gocog depends: ../*.json /abs/path\n// gocog]]]\n// [[[end]]]"
+	if err := ioutil.WriteFile(file, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(file, &Options{StartMark: "[[["})
+	deps, err := p.Dependencies()
+	if err != nil {
+		t.Fatalf("Dependencies: unexpected error: %v", err)
+	}
+	expected := []string{
+		filepath.Join(dir, "schema.sql"),
+		filepath.Join(filepath.Dir(dir), "*.json"),
+		filepath.FromSlash("/abs/path"),
+	}
+	if !reflect.DeepEqual(deps, expected) {
+		t.Errorf("Dependencies: Expected %q, got %q", expected, deps)
+	}
+}
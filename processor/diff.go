@@ -0,0 +1,194 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change in a unified diff.
+const diffContext = 3
+
+// diffOp is a single line of an edit script: a line kept (' '), removed ('-') or added ('+').
+// a and b are the number of lines of the old and new text that come before it.
+type diffOp struct {
+	kind byte
+	line string
+	a, b int
+}
+
+// unifiedDiff returns a unified diff that turns old into new, with the given file names in its header.
+// It returns nil if old and new are identical.
+func unifiedDiff(oldName, newName string, old, new []byte) []byte {
+	ops := diffLines(splitLines(old), splitLines(new))
+
+	buf := &bytes.Buffer{}
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// extend the hunk over any changes close enough that their context would overlap
+		end := i + 1
+		for j := end; j < len(ops) && j-end < 2*diffContext; j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			}
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		stop := end + diffContext
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		if buf.Len() == 0 {
+			fmt.Fprintf(buf, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		writeHunk(buf, ops[start:stop])
+		i = stop
+	}
+
+	if buf.Len() == 0 {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// writeHunk writes the given operations to buf as a single hunk of a unified diff.
+func writeHunk(buf *bytes.Buffer, ops []diffOp) {
+	oldCount, newCount := 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(ops[0].a, oldCount), hunkRange(ops[0].b, newCount))
+	for _, op := range ops {
+		buf.WriteByte(op.kind)
+		buf.WriteString(op.line)
+		if !strings.HasSuffix(op.line, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats the range of lines covered by a hunk, given the number of lines before it.
+// An empty range is numbered by the line before it, as diff does.
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// splitLines splits b into lines, keeping the newline at the end of each.
+func splitLines(b []byte) []string {
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the shortest edit script that turns a into b, using Myers' algorithm.
+func diffLines(a, b []string) []diffOp {
+	// lines common to the start and end don't need to go through the search
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for i := 0; i < pre; i++ {
+		ops = append(ops, diffOp{' ', a[i], i, i})
+	}
+	ops = append(ops, myers(a[pre:len(a)-suf], b[pre:len(b)-suf], pre)...)
+	for i := 0; i < suf; i++ {
+		x, y := len(a)-suf+i, len(b)-suf+i
+		ops = append(ops, diffOp{' ', a[x], x, y})
+	}
+	return ops
+}
+
+// myers returns the edit script that turns a into b. Both are assumed to start
+// after offset lines of common text, which is used to number the operations.
+func myers(a, b []string, offset int) []diffOp {
+	n, m := len(a), len(b)
+	// v[k+size] is the furthest x reached on diagonal k
+	size := n + m + 1
+	v := make([]int, 2*size+1)
+	var trace [][]int
+
+search:
+	for d := 0; d <= n+m; d++ {
+		// only diagonals -d..d can have been reached after d edits
+		trace = append(trace, append([]int(nil), v[size-d:size+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[size+k-1] < v[size+k+1]) {
+				x = v[size+k+1]
+			} else {
+				x = v[size+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[size+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// walk back through the trace to recover the path, from the end to the start
+	var rev []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d] }
+		k := x - y
+		var pk int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := 0
+		if d > 0 {
+			px = at(pk)
+		}
+		py := px - pk
+		for x > px && y > py {
+			x--
+			y--
+			rev = append(rev, diffOp{' ', a[x], offset + x, offset + y})
+		}
+		if d > 0 {
+			if x == px {
+				rev = append(rev, diffOp{'+', b[py], offset + px, offset + py})
+			} else {
+				rev = append(rev, diffOp{'-', a[px], offset + px, offset + py})
+			}
+		}
+		x, y = px, py
+	}
+
+	ops := make([]diffOp, len(rev))
+	for i, op := range rev {
+		ops[len(rev)-1-i] = op
+	}
+	return ops
+}
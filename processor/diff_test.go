@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type DiffData struct {
+	old  string
+	new  string
+	diff string
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []DiffData{
+		{"", "", ""},
+		{"a\nb\n", "a\nb\n", ""},
+		{"", "a\n", "@@ -0,0 +1,1 @@\n+a\n"},
+		{"a\n", "", "@@ -1,1 +0,0 @@\n-a\n"},
+		{"a\nb\nc\n", "a\nx\nc\n", "@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"a\nb", "a\nb\n", "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n"},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "1\nx\n3\n4\n5\n6\n7\n8\n9\n10\ny\n12\n",
+			"@@ -1,5 +1,5 @@\n 1\n-2\n+x\n 3\n 4\n 5\n@@ -8,5 +8,5 @@\n 8\n 9\n 10\n-11\n+y\n 12\n"},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n", "1\nx\n3\n4\n5\n6\n7\ny\n",
+			"@@ -1,8 +1,8 @@\n 1\n-2\n+x\n 3\n 4\n 5\n 6\n 7\n-8\n+y\n"},
+		{"a\nb\nc\na\nb\nb\na\n", "c\nb\na\nb\na\nc\n",
+			"@@ -1,7 +1,6 @@\n-a\n-b\n c\n+b\n a\n b\n-b\n a\n+c\n"},
+	}
+
+	for i, test := range tests {
+		d := unifiedDiff("a/f", "b/f", []byte(test.old), []byte(test.new))
+		expected := ""
+		if test.diff != "" {
+			expected = "--- a/f\n+++ b/f\n" + test.diff
+		}
+		if string(d) != expected {
+			t.Errorf("UnifiedDiff Test %d: Expected diff:\n'%s'\nGot diff:\n'%s'", i, expected, d)
+		}
+	}
+}
+
+func TestUnifiedDiffApplies(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	old := "package foo\n\n// [[[gocog\n// gocog]]]\nvar a = 1\nvar b = 2\n// [[[end]]]\n\nfunc f() {}\n"
+	new := "package foo\n\n// [[[gocog\n// gocog]]]\nvar a = 1\nvar c = 3\nvar d = 4\n// [[[end]]]\n\nfunc f() {}\nfunc g() {}"
+
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "foo.go")
+	if err := ioutil.WriteFile(file, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("git", "apply")
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(unifiedDiff("a/foo.go", "b/foo.go", []byte(old), []byte(new)))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("UnifiedDiffApplies: git apply failed: %v\n%s", err, out)
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != new {
+		t.Errorf("UnifiedDiffApplies: Expected patched file:\n'%s'\nGot:\n'%s'", new, strings.TrimSpace(string(b)))
+	}
+}
+
+func TestRunDiffNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+	inside := filepath.Join(root, "sub", "in.txt")
+	outside := filepath.Join(dir, "other", "out.txt")
+	for _, file := range []string{inside, outside} {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(exciseInput), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	relInside, err := filepath.Rel(wd, inside)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file string
+		name string
+	}{
+		{inside, "sub/in.txt"},
+		// a relative name is named from the root all the same
+		{relInside, "sub/in.txt"},
+		// a file outside the root can't be reached with ..
+		{outside, filepath.ToSlash(outside)},
+	}
+	for i, test := range tests {
+		p := New(test.file, &Options{StartMark: "[[[", EndMark: "]]]", Excise: true, DryRun: true, Quiet: true})
+		p.Root = root
+		if err := p.Run(); err != nil {
+			t.Fatalf("RunDiffNames Test %d: unexpected error: %v", i, err)
+		}
+		expected := string(unifiedDiff("a/"+test.name, "b/"+test.name, []byte(exciseInput), []byte(exciseOutput)))
+		if string(p.Diff) != expected {
+			t.Errorf("RunDiffNames Test %d: Expected diff:\n'%s'\nGot diff:\n'%s'", i, expected, p.Diff)
+		}
+	}
+}
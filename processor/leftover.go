@@ -0,0 +1,125 @@
+package processor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+var (
+	// the names gocog gives its temporary files, as made by createTemp from outputPrefix and
+	// generatorPrefix, and by lockName, capturing the name of the file they were made for
+	outputName    = regexp.MustCompile(fmt.Sprintf(`^(.+)_cog_[0-9a-f]{%d}$`, tempRandLen))
+	generatorName = regexp.MustCompile(fmt.Sprintf(`^cog_(.+)_cog_[0-9]+_[0-9a-f]{%d}(\..*)?$`, tempRandLen))
+	lockFileName  = regexp.MustCompile(`^(.+)_cog\.lock$`)
+)
+
+// leftoverOf returns the base name of the file that the temporary file with the given
+// base name was made for, or "" if it isn't named like one of gocog's temporary files.
+func leftoverOf(name string) string {
+	for _, re := range []*regexp.Regexp{generatorName, outputName, lockFileName} {
+		if m := re.FindStringSubmatch(name); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// FindLeftovers returns the temporary files in dir left behind by gocog runs that were
+// interrupted, mapping the path of each file they were made for to their paths, in order.
+// Only files named like gocog's temporary files, for a file that exists, are returned,
+// and lock files only if they are empty, as gocog's always are.
+// Files for a file that another gocog is processing right now may be returned too;
+// RemoveLeftovers leaves those alone.
+func FindLeftovers(dir string) (map[string][]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string][]string{}
+	for _, info := range infos {
+		orig := leftoverOf(info.Name())
+		if orig == "" || info.IsDir() {
+			continue
+		}
+		if lockFileName.MatchString(info.Name()) && info.Size() != 0 {
+			continue
+		}
+		file := filepath.Join(dir, orig)
+		if fi, err := os.Stat(file); err != nil || fi.IsDir() {
+			continue
+		}
+		found[file] = append(found[file], filepath.Join(dir, info.Name()))
+	}
+	for _, names := range found {
+		sort.Strings(names)
+	}
+	return found, nil
+}
+
+// RemoveLeftovers removes the given leftover temporary files made for file, as found by
+// FindLeftovers, including its stale lock file. It returns InUse, without removing anything,
+// if another gocog is processing the file.
+func RemoveLeftovers(file string, names []string) error {
+	lock, err := tryLockFile(file)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		// the lock file is removed when it's unlocked
+		if name == lockName(file) {
+			continue
+		}
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			unlockFile(lock)
+			return err
+		}
+	}
+	return unlockFile(lock)
+}
+
+// Leftovers holds the leftover temporary files found in directories, so that each directory
+// is only read once however many of its files are processed. It may be shared between
+// Processors. The zero value is ready to use.
+type Leftovers struct {
+	mu    sync.Mutex
+	found map[string]map[string][]string
+}
+
+// of returns the leftover temporary files from earlier runs over the file with the given path,
+// other than its lock file. It must be called with the file locked, so that any temporary files
+// found can't belong to another gocog that's still running. The directory may have been read
+// before the file was locked, so only the files that are still there are returned.
+func (l *Leftovers) of(file string) ([]string, error) {
+	dir := filepath.Dir(file)
+	l.mu.Lock()
+	found, ok := l.found[dir]
+	if !ok {
+		var err error
+		if found, err = FindLeftovers(dir); err != nil {
+			l.mu.Unlock()
+			return nil, err
+		}
+		if l.found == nil {
+			l.found = map[string]map[string][]string{}
+		}
+		l.found[dir] = found
+	}
+	l.mu.Unlock()
+
+	var names []string
+	for _, name := range found[file] {
+		if name == lockName(file) {
+			continue
+		}
+		if _, err := os.Lstat(name); err == nil {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type LeftoverData struct {
+	name string
+	orig string
+}
+
+func TestLeftoverOf(t *testing.T) {
+	tests := []LeftoverData{
+		{"foo.txt_cog_0123abcd", "foo.txt"},
+		{"cog_foo.txt_cog_1_0123abcd.go", "foo.txt"},
+		{"cog_foo.txt_cog_12_0123abcd", "foo.txt"},
+		{"foo.txt_cog.lock", "foo.txt"},
+		{"foo.txt", ""},
+		{"foo.txt_cog_", ""},
+		{"foo.txt_cog_1", ""},
+		{"foo.txt_cog_123456", ""},
+		{"foo.txt_cog_0123ABCD", ""},
+		{"foo.txt_cog_0123abcde", ""},
+		{"cog_foo.txt_cog_1_123456.go", ""},
+		{"cog_foo.txt_cog_1.go", ""},
+		{"foo.txt_cog.lock.bak", ""},
+	}
+
+	for i, test := range tests {
+		if orig := leftoverOf(test.name); orig != test.orig {
+			t.Errorf("LeftoverOf Test %d: Expected %q, Got %q", i, test.orig, orig)
+		}
+	}
+}
+
+func TestRemoveLeftovers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "foo.txt")
+	names := []string{"bar.txt_cog_0123abcd", "cog_foo.txt_cog_1_0123abcd.go", "foo.txt", "foo.txt_cog_89abcdef",
+		// near misses that belong to the user
+		"foo.txt_cog_1", "foo.txt_cog_notes", "cog_foo.txt_cog_1_2.go", "notes"}
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// gocog's lock files are empty, so this one belongs to the user too
+	if err := ioutil.WriteFile(filepath.Join(dir, "notes_cog.lock"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := FindLeftovers(dir)
+	if err != nil {
+		t.Fatalf("FindLeftovers: unexpected error: %v", err)
+	}
+	expected := map[string][]string{
+		file: {filepath.Join(dir, "cog_foo.txt_cog_1_0123abcd.go"), filepath.Join(dir, "foo.txt_cog_89abcdef")},
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Fatalf("FindLeftovers: Expected %q, Got %q", expected, found)
+	}
+
+	lock, err := lockFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveLeftovers(file, found[file]); err != InUse {
+		t.Errorf("RemoveLeftovers: Expected InUse while the file is locked, Got %v", err)
+	}
+	if err := unlockFile(lock); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RemoveLeftovers(file, found[file]); err != nil {
+		t.Fatalf("RemoveLeftovers: unexpected error: %v", err)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, info := range infos {
+		left = append(left, info.Name())
+	}
+	if expected := []string{"bar.txt_cog_0123abcd", "cog_foo.txt_cog_1_2.go", "foo.txt", "foo.txt_cog_1", "foo.txt_cog_notes", "notes", "notes_cog.lock"}; !reflect.DeepEqual(left, expected) {
+		t.Errorf("RemoveLeftovers: Expected %q to be left, Got %q", expected, left)
+	}
+}
+
+func TestLeftoversOf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a.txt", "b.txt", "a.txt_cog_0123abcd", "a.txt_cog.lock", "b.txt_cog_89abcdef"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var l Leftovers
+	names, err := l.of(filepath.Join(dir, "a.txt"))
+	if err != nil {
+		t.Fatalf("LeftoversOf: unexpected error: %v", err)
+	}
+	if expected := []string{filepath.Join(dir, "a.txt_cog_0123abcd")}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("LeftoversOf: Expected %q without the lock file, Got %q", expected, names)
+	}
+
+	// the directory is only read once, so a file made since isn't seen, and one removed since isn't returned
+	if err := ioutil.WriteFile(filepath.Join(dir, "cog_b.txt_cog_1_0123abcd.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "b.txt_cog_89abcdef")); err != nil {
+		t.Fatal(err)
+	}
+	if names, err := l.of(filepath.Join(dir, "b.txt")); err != nil || len(names) != 0 {
+		t.Errorf("LeftoversOf: Expected no leftovers from the directory as first read, Got %q, %v", names, err)
+	}
+}
@@ -0,0 +1,28 @@
+package processor
+
+// Limiter bounds the number of generator processes that may run at once.
+// A nil Limiter imposes no limit.
+type Limiter chan struct{}
+
+// NewLimiter returns a Limiter that allows at most n concurrent generators.
+// If n is less than 1, the returned Limiter allows only one.
+func NewLimiter(n int) Limiter {
+	if n < 1 {
+		n = 1
+	}
+	return make(Limiter, n)
+}
+
+// acquire blocks until a slot is available.
+func (l Limiter) acquire() {
+	if l != nil {
+		l <- struct{}{}
+	}
+}
+
+// release frees a slot taken by acquire.
+func (l Limiter) release() {
+	if l != nil {
+		<-l
+	}
+}
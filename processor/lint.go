@@ -0,0 +1,203 @@
+package processor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The rules that findings may break, by ID.
+const (
+	MissingEnd         = "missing-end"
+	UnterminatedCode   = "unterminated-code"
+	NestedStart        = "nested-start"
+	StrayEnd           = "stray-end"
+	NoOutput           = "no-output"
+	QuotedMarker       = "quoted-marker"
+	InconsistentPrefix = "inconsistent-prefix"
+	MissingPrefix      = "missing-prefix"
+	StaleOutput        = "stale-output"
+)
+
+// Rule describes a rule that findings may break. Breaking a rule that's only a warning
+// doesn't stop a file being processed, but may mean it isn't processed as intended.
+type Rule struct {
+	Description string
+	Warning     bool
+}
+
+// Rules describes each rule, by ID.
+var Rules = map[string]Rule{
+	MissingEnd:         {"Each block's output must be followed by an end marker", false},
+	UnterminatedCode:   {"Each block's generator code must be followed by a gocog end marker", false},
+	NestedStart:        {"Generator code should not contain another start marker", true},
+	StrayEnd:           {"End markers should only appear after a start marker", true},
+	NoOutput:           {"A block's end marker should be on a line after its gocog end marker, since one on the same line is ignored", true},
+	QuotedMarker:       {"Markers inside string literals are still treated as markers", true},
+	InconsistentPrefix: {"The markers of a block should have the same prefix as its start marker", true},
+	MissingPrefix:      {"Each line of generator code should start with the block's prefix if any do", true},
+	StaleOutput:        {"Generated output must be up to date with its generator code", false},
+}
+
+// Finding is a problem found in a file. Lines and columns count from 1,
+// and EndLine is the last line of the problem.
+type Finding struct {
+	Rule    string
+	Message string
+	Line    int
+	Column  int
+	EndLine int
+}
+
+// Lint checks the gocog markers in the file, without running the generators, and returns
+// the problems found in the order they appear. It reads the file line by line with the same
+// markers as Run, but carries on past problems that would stop Run, so it can report them all.
+func (p *Processor) Lint() ([]Finding, error) {
+	in, err := p.open()
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	start := p.StartMark + "gocog"
+	codeEnd := "gocog" + p.EndMark
+	end := p.StartMark + "end" + p.EndMark
+
+	var findings []Finding
+	add := func(rule string, line, col, endLine int, format string, v ...interface{}) {
+		findings = append(findings, Finding{rule, fmt.Sprintf(format, v...), line, col, endLine})
+	}
+
+	const (
+		inText = iota
+		inCode
+		inOutput
+	)
+	state := inText
+
+	// the current block: its number in the file, the line and column of its start marker, and its prefix
+	n, blockLine, blockCol, prefix := 0, 0, 0, ""
+	// the lines of the current block's generator code with and without the prefix
+	prefixed, unprefixed := 0, []int(nil)
+
+	// marker returns the column of the marker in the line, or 0 if it's not there,
+	// and checks that it's not in a string literal and has the block's prefix
+	marker := func(line string, num int, m string, checkPrefix bool) int {
+		col := column(line, m)
+		if col == 0 {
+			return 0
+		}
+		if quoted(line, strings.Index(line, m)) {
+			add(QuotedMarker, num, col, num, "Marker %s is inside a string literal, but is still treated as a marker", m)
+		}
+		if checkPrefix {
+			if pre := strings.TrimSpace(getPrefix(line, m)); pre != "" && pre != strings.TrimSpace(prefix) {
+				add(InconsistentPrefix, num, col, num, "Marker %s has prefix %q, but block %d started with %q", m, pre, n, strings.TrimSpace(prefix))
+			}
+		}
+		return col
+	}
+	startBlock := func(line string, num, col int) {
+		n++
+		blockLine, blockCol, prefix = num, col, getPrefix(line, start)
+		prefixed, unprefixed = 0, nil
+		if column(line, codeEnd) > column(line, start) {
+			add(NoOutput, num, col, num, "Block %d has its gocog end marker on its start line, where it's ignored", n)
+		}
+	}
+
+	r := bufio.NewReader(in)
+	num := 0
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if line != "" {
+			num++
+			switch state {
+			case inText:
+				if col := marker(line, num, start, false); col > 0 {
+					state = inCode
+					startBlock(line, num, col)
+				} else if col := column(line, codeEnd); col > 0 {
+					add(StrayEnd, num, col, num, "Marker %s outside of any block", codeEnd)
+				} else if col := column(line, end); col > 0 {
+					add(StrayEnd, num, col, num, "Marker %s outside of any block", end)
+				}
+			case inCode:
+				if col := marker(line, num, codeEnd, true); col > 0 {
+					state = inOutput
+					if prefix != "" && prefixed > 0 {
+						for _, l := range unprefixed {
+							add(MissingPrefix, l, 1, l, "Line of generator code in block %d doesn't start with the prefix %q", n, strings.TrimSpace(prefix))
+						}
+					}
+					if endCol := column(line, end); endCol > col {
+						add(NoOutput, num, endCol, num, "Block %d has its end marker on the same line as its gocog end marker, where it's ignored", n)
+					}
+				} else if col := column(line, start); col > 0 {
+					add(NestedStart, num, col, num, "Start marker inside the generator code of block %d, which starts on line %d", n, blockLine)
+				} else if strings.TrimSpace(line) != "" {
+					if strings.HasPrefix(strings.TrimLeftFunc(line, unicode.IsSpace), prefix) {
+						prefixed++
+					} else {
+						unprefixed = append(unprefixed, num)
+					}
+				}
+			case inOutput:
+				if marker(line, num, end, true) > 0 {
+					state = inText
+				} else if col := marker(line, num, start, false); col > 0 {
+					add(MissingEnd, blockLine, blockCol, num-1, "Block %d has no end marker before the next block starts on line %d", n, num)
+					state = inCode
+					startBlock(line, num, col)
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	switch {
+	case state == inCode:
+		add(UnterminatedCode, blockLine, blockCol, num, "The generator code of block %d has no gocog end marker", n)
+	case state == inOutput && !p.UseEOF:
+		add(MissingEnd, blockLine, blockCol, num, "Block %d has no end marker before the end of the file", n)
+	}
+	return findings, nil
+}
+
+// column returns the column of the first character of marker in line, counting from 1,
+// or 0 if the line doesn't contain it.
+func column(line, marker string) int {
+	i := strings.Index(line, marker)
+	if i < 0 {
+		return 0
+	}
+	return utf8.RuneCountInString(line[:i]) + 1
+}
+
+// quoted reports whether the byte at i in line is inside a string literal delimited by
+// double quotes or backquotes. Single quotes are left out, since they are so often apostrophes.
+func quoted(line string, i int) bool {
+	var open rune
+	escaped := false
+	for _, c := range line[:i] {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && open == '"':
+			escaped = true
+		case open == 0 && (c == '"' || c == '`'):
+			open = c
+		case c == open:
+			open = 0
+		}
+	}
+	return open != 0
+}
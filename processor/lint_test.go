@@ -0,0 +1,234 @@
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type LintData struct {
+	input    string
+	eof      bool
+	findings []Finding
+}
+
+func TestLint(t *testing.T) {
+	tests := []LintData{
+		{"no cog code\n", false, nil},
+		{"// [[[gocog\n// code\n// gocog]]]\nout\n// [[[end]]]\n", false, nil},
+		{"// [[[gocog\n// code\n// gocog]]]\nout\n", true, nil},
+		{
+			"// [[[gocog\n// code\n// gocog]]]\nout\n",
+			false,
+			[]Finding{{MissingEnd, "", 1, 4, 4}},
+		},
+		{
+			"a\n  # [[[gocog\n# gocog]]]\nout\n# [[[gocog\n# gocog]]]\n# [[[end]]]\n",
+			false,
+			[]Finding{{MissingEnd, "", 2, 5, 4}},
+		},
+		{
+			"// [[[gocog\n// code\n",
+			false,
+			[]Finding{{UnterminatedCode, "", 1, 4, 2}},
+		},
+		{
+			"// [[[gocog\n// x := \"[[[gocog\"\n// gocog]]]\n// [[[end]]]",
+			false,
+			[]Finding{{NestedStart, "", 2, 10, 2}},
+		},
+		{
+			"a [[[end]]]\nb gocog]]]\n",
+			false,
+			[]Finding{{StrayEnd, "", 1, 3, 1}, {StrayEnd, "", 2, 3, 2}},
+		},
+		{
+			"[[[gocog gocog]]]\n[[[end]]]\n",
+			false,
+			[]Finding{{NoOutput, "", 1, 1, 1}, {UnterminatedCode, "", 1, 1, 2}},
+		},
+		{
+			"[[[gocog\ngocog]]] [[[end]]]\n[[[end]]]\n",
+			false,
+			[]Finding{{NoOutput, "", 2, 10, 2}},
+		},
+		{
+			"fmt.Println(\"[[[gocog\")\ngocog]]]\n[[[end]]]\n",
+			false,
+			[]Finding{{QuotedMarker, "", 1, 14, 1}},
+		},
+		{
+			"// [[[gocog\n// a\nb\n\n// c\n# gocog]]]\n// [[[end]]]\n",
+			false,
+			[]Finding{{InconsistentPrefix, "", 6, 3, 6}, {MissingPrefix, "", 3, 1, 3}},
+		},
+		{
+			"/* [[[gocog\na\nb\ngocog]]] */\n[[[end]]]\n",
+			false,
+			nil,
+		},
+		{
+			"é [[[gocog\n",
+			false,
+			[]Finding{{UnterminatedCode, "", 1, 3, 1}},
+		},
+	}
+
+	for i, test := range tests {
+		p := New("foo.txt", &Options{StartMark: "[[[", EndMark: "]]]", UseEOF: test.eof, Quiet: true})
+		p.Input = []byte(test.input)
+		findings, err := p.Lint()
+		if err != nil {
+			t.Errorf("Lint Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if len(findings) != len(test.findings) {
+			t.Errorf("Lint Test %d: Expected %d findings, Got %+v", i, len(test.findings), findings)
+			continue
+		}
+		for j, f := range findings {
+			f.Message = ""
+			if f != test.findings[j] {
+				t.Errorf("Lint Test %d: Expected finding %+v, Got %+v", i, test.findings[j], f)
+			}
+		}
+	}
+}
+
+type QuotedData struct {
+	line   string
+	quoted bool
+}
+
+func TestQuoted(t *testing.T) {
+	tests := []QuotedData{
+		{"// [[[gocog", false},
+		{"\"[[[gocog", true},
+		{"\"a\" [[[gocog", false},
+		{"\"a\\\" [[[gocog", true},
+		{"`a\\` [[[gocog", false},
+		{"`[[[gocog", true},
+		{"# it's [[[gocog", false},
+	}
+
+	for i, test := range tests {
+		if q := quoted(test.line, strings.Index(test.line, "[[[gocog")); q != test.quoted {
+			t.Errorf("Quoted Test %d: Expected %v, Got %v", i, test.quoted, q)
+		}
+	}
+}
+
+type LintNearMissData struct {
+	rule  string
+	input string
+}
+
+// TestLintNearMisses checks each rule doesn't fire on input that comes close to breaking it.
+func TestLintNearMisses(t *testing.T) {
+	tests := []LintNearMissData{
+		{MissingEnd, "// [[[gocog\n// gocog]]]\nout\n# [[[end]]]\n"},
+		{MissingEnd, "[[[gocog\ngocog]]]\n[[[end]]]\n[[[gocog\ngocog]]]\n[[[end]]]\n"},
+		{UnterminatedCode, "[[[gocog\ngocog]]]\n[[[end]]]\n"},
+		{UnterminatedCode, "[[[gocog\ncode\n  gocog]]] trailing\n[[[end]]]\n"},
+		{NestedStart, "[[[gocog\n// [[gocog\n// [[[ gocog\ngocog]]]\n[[[end]]]\n"},
+		{StrayEnd, "text ]]]\n[[end]]\ngocog]]\n"},
+		{StrayEnd, "[[[gocog\ngocog]]]\n[[[end]]]\n"},
+		{NoOutput, "[[[gocog\ngocog]]]\n[[[end]]]\n"},
+		{NoOutput, "gocog]]] [[[gocog\ngocog]]]\n[[[end]]]\n"},
+		{QuotedMarker, "fmt.Println(\"a\") // [[[gocog\ngocog]]]\n[[[end]]]\n"},
+		{QuotedMarker, "# it's [[[gocog\n# gocog]]]\n# [[[end]]]\n"},
+		{InconsistentPrefix, "// [[[gocog\n  //   gocog]]]\n\t// [[[end]]]\n"},
+		{InconsistentPrefix, "// [[[gocog\n// gocog]]]\n[[[end]]]\n"},
+		{MissingPrefix, "// [[[gocog\n// a\n\n  // b\n// gocog]]]\n// [[[end]]]\n"},
+		{MissingPrefix, "// [[[gocog\na\nb\n// gocog]]]\n// [[[end]]]\n"},
+		{MissingPrefix, "[[[gocog\na\nb\ngocog]]]\n[[[end]]]\n"},
+	}
+
+	for i, test := range tests {
+		p := New("foo.txt", &Options{StartMark: "[[[", EndMark: "]]]", Quiet: true})
+		p.Input = []byte(test.input)
+		findings, err := p.Lint()
+		if err != nil {
+			t.Errorf("LintNearMisses Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		for _, f := range findings {
+			if f.Rule == test.rule {
+				t.Errorf("LintNearMisses Test %d: Expected no %s finding, Got %+v", i, test.rule, f)
+			}
+		}
+	}
+}
+
+type LintAgreesData struct {
+	input string
+	eof   bool
+}
+
+// TestLintAgreesWithRun checks that Lint finds an error in exactly the inputs that Run rejects,
+// since Lint reads the markers separately from Run.
+func TestLintAgreesWithRun(t *testing.T) {
+	tests := []LintAgreesData{
+		{"no cog code\n", false},
+		{"// [[[gocog\n// code\n// gocog]]]\nout\n// [[[end]]]\n", false},
+		{"// [[[gocog\n// code\n// gocog]]]\nout\n", true},
+		{"// [[[gocog\n// code\n// gocog]]]\nout\n", false},
+		{"// [[[gocog\n// code\n// gocog]]]\n", true},
+		{"a\n  # [[[gocog\n# gocog]]]\nout\n# [[[gocog\n# gocog]]]\n# [[[end]]]\n", false},
+		{"// [[[gocog\n// code\n", false},
+		{"// [[[gocog\n// code\n", true},
+		{"// [[[gocog\n// x := \"[[[gocog\"\n// gocog]]]\n// [[[end]]]", false},
+		{"a [[[end]]]\nb gocog]]]\n", false},
+		{"[[[gocog gocog]]]\n[[[end]]]\n", false},
+		{"[[[gocog\ngocog]]] [[[end]]]\n[[[end]]]\n", false},
+		{"[[[gocog\ngocog]]] [[[end]]]\n", false},
+		{"fmt.Println(\"[[[gocog\")\ngocog]]]\n[[[end]]]\n", false},
+		{"// [[[gocog\n// a\nb\n\n// c\n# gocog]]]\n// [[[end]]]\n", false},
+		{"[[[gocog\ngocog]]]\n[[[end]]]\n[[[gocog\ngocog]]]\n[[[end]]]\n", false},
+		{"[[[gocog\ncode\n  gocog]]] trailing\n[[[end]]]\n", false},
+		{"[[[gocog\n// [[gocog\n// [[[ gocog\ngocog]]]\n[[[end]]]\n", false},
+		{"gocog]]] [[[gocog\ngocog]]]\n[[[end]]]\n", false},
+		{"[[[gocog\ngocog]]]\nout [[[end]]] more\n", false},
+		{"[[[gocog\ngocog]]]\n[[[gocog\ngocog]]]\n[[[end]]]\n", false},
+		{"[[[gocog\ngocog]]]\n[[[gocog\ngocog]]]\n", true},
+	}
+
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "foo.txt")
+
+	for i, test := range tests {
+		if err := ioutil.WriteFile(name, []byte(test.input), 0644); err != nil {
+			t.Fatal(err)
+		}
+		p := New(name, &Options{StartMark: "[[[", EndMark: "]]]", UseEOF: test.eof, Quiet: true})
+		findings, err := p.Lint()
+		if err != nil {
+			t.Errorf("LintAgreesWithRun Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		var lintErr *Finding
+		for j, f := range findings {
+			if !Rules[f.Rule].Warning {
+				lintErr = &findings[j]
+				break
+			}
+		}
+
+		// excising reads every block without running the generators
+		p = New(name, &Options{StartMark: "[[[", EndMark: "]]]", UseEOF: test.eof, Quiet: true, Excise: true})
+		runErr := p.Run()
+		if runErr == NoCogCode {
+			runErr = nil
+		}
+
+		if (lintErr == nil) != (runErr == nil) {
+			t.Errorf("LintAgreesWithRun Test %d: Lint found %+v, but Run returned %v, for:\n%s", i, lintErr, runErr, test.input)
+		}
+	}
+}
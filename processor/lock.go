@@ -0,0 +1,34 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+)
+
+// lockName returns the name of the lock file guarding the given file.
+func lockName(file string) string {
+	return file + "_cog.lock"
+}
+
+// lockFile takes an exclusive lock on the given file, waiting until any other
+// gocog process working on the same file has released it.
+func lockFile(file string) (*os.File, error) {
+	return lock(lockName(file), true)
+}
+
+// tryLockFile takes an exclusive lock on the given file, or returns InUse if another
+// gocog process is working on the same file.
+func tryLockFile(file string) (*os.File, error) {
+	return lock(lockName(file), false)
+}
+
+// unlockFile removes the lock file and releases the lock taken by lockFile.
+func unlockFile(f *os.File) error {
+	return unlock(f)
+}
+
+// notLockFile returns the error for a file with the name of a lock file that isn't empty.
+// gocog's lock files are always empty, so the file isn't one of them and is left alone.
+func notLockFile(name string) error {
+	return fmt.Errorf("Cannot lock: %s is not empty, so it is not a gocog lock file", name)
+}
@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "foo")
+
+	first, err := lockFile(file)
+	if err != nil {
+		t.Fatalf("LockFile: unexpected error taking first lock: %v", err)
+	}
+
+	locked := make(chan error)
+	go func() {
+		second, err := lockFile(file)
+		if err == nil {
+			err = unlockFile(second)
+		}
+		locked <- err
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("LockFile: second lock taken while first was held")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := unlockFile(first); err != nil {
+		t.Fatalf("LockFile: unexpected error releasing first lock: %v", err)
+	}
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatalf("LockFile: unexpected error from second lock: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("LockFile: second lock not taken after first was released")
+	}
+
+	if _, err := os.Stat(lockName(file)); !os.IsNotExist(err) {
+		t.Errorf("LockFile: Expected lock file to be removed, got: %v", err)
+	}
+}
+
+func TestLockFileLeavesOtherFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "notes")
+
+	// a file of the user's that happens to have the lock file's name
+	if err := ioutil.WriteFile(lockName(file), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := lockFile(file); err == nil {
+		unlockFile(f)
+		t.Fatal("LockFileLeavesOtherFiles: Expected an error locking over a non-empty file")
+	}
+	b, err := ioutil.ReadFile(lockName(file))
+	if err != nil || string(b) != "notes" {
+		t.Errorf("LockFileLeavesOtherFiles: Expected the file to be left alone, got %q, %v", b, err)
+	}
+}
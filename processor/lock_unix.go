@@ -0,0 +1,63 @@
+//go:build !windows
+// +build !windows
+
+package processor
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock creates the lock file with the given name if it does not exist and takes
+// an exclusive lock on it. If wait is true, it blocks until the lock is available,
+// otherwise it returns InUse if another process holds the lock.
+func lock(name string, wait bool) (*os.File, error) {
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0666)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(f.Fd()), how); err != nil {
+			f.Close()
+			if err == syscall.EWOULDBLOCK {
+				return nil, InUse
+			}
+			return nil, err
+		}
+
+		// The previous holder removes the lock file when it is done, so if we were
+		// waiting on it, the lock we now hold is on a file nobody else can see.
+		// In that case start over with whatever is at name now.
+		held, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		current, err := os.Stat(name)
+		if err == nil && os.SameFile(held, current) {
+			if held.Size() != 0 {
+				f.Close()
+				return nil, notLockFile(name)
+			}
+			return f, nil
+		}
+		f.Close()
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+}
+
+// unlock removes the lock file and releases the lock. The file is removed before
+// the lock is released, so it is never removed out from under another holder.
+func unlock(f *os.File) error {
+	err := os.Remove(f.Name())
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
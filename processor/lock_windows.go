@@ -0,0 +1,56 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// lockPoll is how long to wait between attempts to create a lock file.
+const lockPoll = 100 * time.Millisecond
+
+// errSharingViolation is the error windows gives for removing a file that another process has open.
+const errSharingViolation = syscall.Errno(32)
+
+// lock creates the lock file with the given name. If the file already exists and can be removed,
+// it was left behind by a gocog that crashed, so it is removed and created afresh. Otherwise
+// another gocog holds it open, and if wait is true, lock waits until it is released, or else
+// returns InUse.
+func lock(name string, wait bool) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			return f, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(name); err == nil && info.Size() != 0 {
+			return nil, notLockFile(name)
+		}
+		err = os.Remove(name)
+		if err == nil || os.IsNotExist(err) {
+			continue
+		}
+		if !wait {
+			return nil, InUse
+		}
+		if !errors.Is(err, errSharingViolation) {
+			return nil, fmt.Errorf("Cannot remove stale lock file %s: %s; remove it with gocog clean", name, err)
+		}
+		time.Sleep(lockPoll)
+	}
+}
+
+// unlock closes and removes the lock file. Open files cannot be removed on windows, so another
+// gocog may remove the file as stale, or even create its own, between the two. Either way the
+// lock has been released, so failing to remove the file is not an error.
+func unlock(f *os.File) error {
+	err := f.Close()
+	if err2 := os.Remove(f.Name()); err == nil && !os.IsNotExist(err2) && !errors.Is(err2, errSharingViolation) {
+		err = err2
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockFileRemovesStaleLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "foo")
+
+	// a lock file nobody has open, as left by a gocog that crashed
+	if err := ioutil.WriteFile(lockName(file), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan error)
+	go func() {
+		f, err := lockFile(file)
+		if err == nil {
+			err = unlockFile(f)
+		}
+		locked <- err
+	}()
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatalf("LockFileRemovesStaleLock: unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("LockFileRemovesStaleLock: lock not taken over a stale lock file")
+	}
+}
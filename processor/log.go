@@ -0,0 +1,45 @@
+package processor
+
+import (
+	"io"
+	"log/slog"
+)
+
+// LevelQuiet is the log level of the Quiet option, above any level gocog logs at.
+const LevelQuiet = slog.LevelError + 4
+
+// NewLogger returns a logger writing to w in the given format, text or json,
+// that drops messages below the given level.
+func NewLogger(w io.Writer, format string, level slog.Leveler) *slog.Logger {
+	o := &slog.HandlerOptions{Level: level}
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(w, o))
+	}
+	return slog.New(slog.NewTextHandler(w, o))
+}
+
+// LogLevel returns the lowest level of the messages logged with the options: nothing at all
+// with the Quiet option, otherwise the Level option if it's set, or debug with the Verbose option.
+func (o *Options) LogLevel() slog.Level {
+	switch {
+	case o.Quiet:
+		return LevelQuiet
+	case o.Level != "":
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(o.Level)); err == nil {
+			return level
+		}
+	case o.Verbose:
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
+
+// logger returns the logger for the Processor's messages, with the file's path attached.
+func (p *Processor) logger() *slog.Logger {
+	l := p.Logger
+	if l == nil {
+		l = slog.Default()
+	}
+	return l.With("file", p.File)
+}
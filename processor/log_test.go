@@ -0,0 +1,29 @@
+package processor
+
+import (
+	"log/slog"
+	"testing"
+)
+
+type LogLevelData struct {
+	opts  Options
+	level slog.Level
+}
+
+func TestLogLevel(t *testing.T) {
+	tests := []LogLevelData{
+		{Options{}, slog.LevelInfo},
+		{Options{Verbose: true}, slog.LevelDebug},
+		{Options{Quiet: true}, LevelQuiet},
+		{Options{Level: "warn"}, slog.LevelWarn},
+		{Options{Level: "error"}, slog.LevelError},
+		{Options{Level: "info", Verbose: true}, slog.LevelInfo},
+		{Options{Level: "debug", Quiet: true}, LevelQuiet},
+		{Options{Level: "bogus"}, slog.LevelInfo},
+	}
+	for i, test := range tests {
+		if level := test.opts.LogLevel(); level != test.level {
+			t.Errorf("LogLevel Test %d: Expected %v, Got %v", i, test.level, level)
+		}
+	}
+}
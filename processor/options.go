@@ -1,17 +1,37 @@
 package processor
 
+// Options are the options for processing a file.
 type Options struct {
-	UseEOF    bool     `short:"z" long:"eof" description:"The end marker can be assumed at eof."`
-	Verbose   bool     `short:"v" long:"verbose" description:"enables verbose output"`
-	Quiet     bool     `short:"q" long:"quiet" description:"turns off all output"`
-	Serial    bool     `short:"S" long:"serial" description:"Write to the specified cog files serially"`
-	Command   string   `short:"c" long:"cmd" description:"The command used to run the generator code"`
-	Args      []string `short:"a" long:"args" description:"Comma separated arguments to cmd, %s for the code file"`
-	Ext       string   `short:"e" long:"ext" description:"Extension to append to the generator filename"`
-	StartMark string   `short:"M" long:"startmark" description:"String that starts gocog statements"`
-	EndMark   string   `short:"E" long:"endmark" description:"String that ends gocog statements"`
-	Excise    bool     `short:"x" long:"excise" description:"Excise all the generated output without running the generators."`
-	Version   bool     `short:"V" long:"version" description:"Display the version of gocog"`
+	// UseEOF lets the end marker of the last block be left out, so its output runs to the end of the file.
+	UseEOF bool
+	// Level is the lowest level of the messages logged: debug, info, warn or error.
+	// Verbose is short for debug, and Quiet turns off logging and the generators' stderr.
+	Level   string
+	Verbose bool
+	Quiet   bool
+	// Parallel runs the generators within the file concurrently.
+	Parallel bool
+	// StreamStderr writes each line the generators write to stderr as soon as it's written,
+	// instead of when they exit.
+	StreamStderr bool
+	// Command runs the generator code of each block with Args, where %s is replaced by the name
+	// of the file holding the code, which ends with Ext.
+	Command string
+	Args    []string
+	Ext     string
+	// StartMark and EndMark start and end the gocog markers.
+	StartMark string
+	EndMark   string
+	// DryRun runs the generators and records the diff of the changes instead of writing them.
+	DryRun bool
+	// Check runs the generators and records whether the file is out of date, without writing anything.
+	Check bool
+	// Excise removes the generated output without running the generators.
+	Excise bool
+	// PreserveOwner gives the regenerated file the owner and group of the original,
+	// and PreserveXattrs copies the extended attributes of the original to it.
+	PreserveOwner  bool
+	PreserveXattrs bool
 	//	Checksum bool              `short:"c" description:"Checksum the output to protect it against accidental change."`
 	//	Delete   bool              `short:"d" description:"Delete the generator code from the output file."`
 	//	Define   map[string]string `short:"D" description:"Define a global string available to your generator code."`
@@ -4,20 +4,26 @@ package processor
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
 	// Indicates a file was processed, but no gocog markers were found in it
 	NoCogCode = errors.New("NoCogCode")
 
+	// Indicates a file could not be locked because another gocog is processing it
+	InUse = errors.New("InUse")
+
 	newline byte = 10
 )
 
@@ -26,79 +32,282 @@ func New(file string, opt *Options) *Processor {
 	if opt == nil {
 		opt = &Options{}
 	}
-
-	var logger *log.Logger
-	if opt.Quiet {
-		logger = log.New(ioutil.Discard, "", log.LstdFlags)
-	} else {
-		logger = log.New(os.Stdout, "", log.LstdFlags)
+	p := &Processor{File: file, Options: opt, Logger: NewLogger(os.Stderr, "", opt.LogLevel())}
+	if !opt.Quiet {
+		p.Stderr = os.Stderr
 	}
-	return &Processor{file, opt, logger}
+	return p
 }
 
 // Processor holds the data for generating code for a specific file.
 type Processor struct {
 	File string
 	*Options
-	*log.Logger
-}
 
-// tracef will only log if verbose output is enabled.
-func (p *Processor) tracef(format string, v ...interface{}) {
-	if p.Verbose {
-		p.Printf(format, v...)
-	}
+	// Logger receives the Processor's log messages, each with the file's path in a "file"
+	// attribute. New sets it to log text to stderr at the level the options say, but it may be
+	// replaced, for instance to log JSON or send the messages elsewhere. If it's nil, slog's
+	// default logger is used.
+	Logger *slog.Logger
+
+	// Stderr receives what the generators write to stderr, with each line prefixed with the file
+	// and block it came from, as file:block:. New sets it to os.Stderr unless the Quiet option is set.
+	// If it's nil, the generators' stderr is only kept in Results and errors.
+	Stderr io.Writer
+
+	// Changed reports whether the last call to Run modified the file,
+	// or with the DryRun option, would have modified it.
+	Changed bool
+
+	// Input, if not nil, is used as the contents of the file instead of reading it from disk,
+	// for instance to check the contents staged in git. The file is never written when Input is set.
+	Input []byte
+
+	// Diff holds the unified diff of the changes found by the last call to Run
+	// with the DryRun or Check option, or with Input set.
+	Diff []byte
+
+	// Root is the directory the file is named relative to in the header of Diff, so that
+	// the diffs of many files make a patch that applies from there. If it's empty, the
+	// working directory is used. A file outside Root is named by its absolute path.
+	Root string
+
+	// Limit bounds the number of generators running at once. It may be shared
+	// between Processors to apply a single limit across many files.
+	Limit Limiter
+
+	// Leftovers finds the temporary files left by interrupted runs over the file, which are
+	// warned about. It may be shared between Processors, so that each directory is only read
+	// once. If it's nil, the file's directory is read each time Run is called.
+	Leftovers *Leftovers
+
+	// Watch, if not nil, is told when each generator starts and finishes running.
+	Watch Watcher
+
+	// Results holds the result of each generator run by the last call to Run, in the order
+	// of the blocks in the file. Start is when the call started, and Duration how long it took.
+	Results  []BlockResult
+	Start    time.Time
+	Duration time.Duration
+
+	mu       sync.Mutex
+	previous map[int][]byte        // the output in the file before the last call to Run, by block
+	parsed   map[int]time.Duration // the time spent reading each block in the last call to Run
 }
 
 // Run processes the input file with the options specified.
 // This will read the file, rewriting to a temporary file
 // then run any embedded code, using the given options.
 // It cleans up and code files it writes, and only overwrites the
-// original if generation was successful.
+// original if generation was successful and changed its contents.
+// With the DryRun or Check options, or when Input is set, nothing is
+// overwritten, and Changed reports whether the file is out of date.
 func (p *Processor) Run() error {
-	p.tracef("Processing file '%s'", p.File)
+	log := p.logger()
+	log.Debug("Processing file")
+	p.Changed = false
+	p.Diff = nil
+	p.Results = nil
+	p.Start = time.Now()
+	defer func() {
+		p.finishResults()
+		p.Duration = time.Since(p.Start)
+	}()
+
+	// most files in a large tree have no gocog code, so check cheaply
+	// before creating any lock or output files
+	found, err := p.hasCogCode()
+	if err != nil {
+		log.Error("Error processing cog file", "err", err)
+		return err
+	}
+	if !found {
+		log.Info("No generator code found")
+		return NoCogCode
+	}
 
-	output, err := p.tryCog()
-	p.tracef("Output file: '%s'", output)
+	// if the file is a symlink, it's the file it points to that we regenerate
+	target, err := filepath.EvalSymlinks(p.File)
+	if err != nil {
+		log.Error("Error processing cog file", "err", err)
+		return err
+	}
+
+	// serialize with any other gocog process working on the same file
+	lock, err := lockFile(target)
+	if err != nil {
+		log.Error("Error locking file", "err", err)
+		return err
+	}
+	defer unlockFile(lock)
+
+	// with the lock held, any temporary files for the file were left by an interrupted run
+	leftovers := p.Leftovers
+	if leftovers == nil {
+		leftovers = &Leftovers{}
+	}
+	if names, err := leftovers.of(target); err == nil {
+		for _, name := range names {
+			log.Warn("Found leftover file from an interrupted run, run gocog clean to remove it", "leftover", name)
+		}
+	}
+
+	output, err := p.tryCog(target)
+	log.Debug("Wrote output file", "output", output)
 
 	if err == NoCogCode {
 		if err := os.Remove(output); err != nil {
-			p.Println(err)
+			log.Error("Error removing output file", "output", output, "err", err)
 		}
-		p.Printf("No generator code found in file '%s'", p.File)
+		log.Info("No generator code found")
 		return err
 	}
 
 	// this is the success case - got to the end of the file without any other errors
 	if err == io.EOF {
-		if err := os.Remove(p.File); err != nil {
-			p.Printf("Error removing original file '%s': %s", p.File, err)
+		same, err := p.unchanged(target, output)
+		if err != nil {
+			log.Error("Error comparing output file to original", "output", output, "err", err)
+			if err := os.Remove(output); err != nil {
+				log.Error("Error removing output file", "output", output, "err", err)
+			}
 			return err
 		}
-		p.tracef("Renaming output file '%s' to original filename '%s'", output, p.File)
-		if err := os.Rename(output, p.File); err != nil {
-			p.Printf("Error renaming cog file '%s': %s", output, err)
+		if same {
+			// leave the original completely untouched, so its modification time doesn't change
+			if err := os.Remove(output); err != nil {
+				log.Error("Error removing output file", "output", output, "err", err)
+			}
+			log.Info("Unchanged")
+			return nil
+		}
+
+		if p.DryRun || p.Check || p.Input != nil {
+			p.Diff, err = p.diff(target, output)
+			if err := os.Remove(output); err != nil {
+				log.Error("Error removing output file", "output", output, "err", err)
+			}
+			if err != nil {
+				log.Error("Error comparing output file to original", "output", output, "err", err)
+				return err
+			}
+			p.Changed = true
+			if p.DryRun {
+				log.Info("Would update")
+			} else {
+				log.Info("Out of date")
+			}
+			return nil
+		}
+
+		log.Debug("Replacing original file with output file", "target", target, "output", output)
+		if err := p.replace(output, target); err != nil {
+			log.Error("Error replacing original file", "err", err)
+			if err := os.Remove(output); err != nil && !os.IsNotExist(err) {
+				log.Error("Error removing output file", "output", output, "err", err)
+			}
 			return err
 		}
-		p.Printf("Successfully processed '%s'", p.File)
+		p.Changed = true
+		log.Info("Updated")
 		return nil
 	} else {
-		p.Printf("Error processing cog file '%s': %s", p.File, err)
+		logged := err
+		if ge, ok := err.(*GeneratorError); ok && p.Stderr != nil {
+			// the generator's stderr has already been written out, so don't repeat it
+			short := *ge
+			short.Stderr = ""
+			logged = &short
+		}
+		log.Error("Error processing cog file", "err", logged)
 		if output != "" {
 			if err := os.Remove(output); err != nil {
-				p.Println(err)
+				log.Error("Error removing output file", "output", output, "err", err)
 			}
 		}
 		return err
 	}
-	return nil
+}
+
+// open opens the input, which is the file, unless the Input field is set.
+func (p *Processor) open() (io.ReadCloser, error) {
+	if p.Input != nil {
+		return ioutil.NopCloser(bytes.NewReader(p.Input)), nil
+	}
+	return os.Open(p.File)
+}
+
+// original returns the contents of the input, reading them from the target file
+// unless the Input field is set.
+func (p *Processor) original(target string) ([]byte, error) {
+	if p.Input != nil {
+		return p.Input, nil
+	}
+	return ioutil.ReadFile(target)
+}
+
+// hasCogCode reports whether the input contains the start mark,
+// reading it without keeping more than a line in memory.
+func (p *Processor) hasCogCode() (bool, error) {
+	in, err := p.open()
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+	return containsLine(bufio.NewReader(in), p.StartMark+"gocog")
+}
+
+// unchanged reports whether the output file has the same contents as the input.
+func (p *Processor) unchanged(target, output string) (bool, error) {
+	if p.Input == nil {
+		return sameContents(target, output)
+	}
+	b, err := ioutil.ReadFile(output)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(b, p.Input), nil
+}
+
+// diff returns a unified diff from the original file to the output file, naming the file
+// as git does so the diff can be applied with git apply or patch -p1.
+func (p *Processor) diff(target, output string) ([]byte, error) {
+	a, err := p.original(target)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(output)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.ToSlash(p.diffName())
+	return unifiedDiff("a/"+name, "b/"+name, a, b), nil
+}
+
+// diffName returns the name of the file for the header of its diff: its path relative to Root,
+// or its absolute path if it isn't below Root, since patches can't reach outside with "..".
+func (p *Processor) diffName() string {
+	name, err := filepath.Abs(p.File)
+	if err != nil {
+		return filepath.Clean(p.File)
+	}
+	root, err := filepath.Abs(p.Root)
+	if err != nil {
+		return name
+	}
+	rel, err := filepath.Rel(root, name)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return name
+	}
+	return rel
 }
 
 // tryCog encapsulates opening the original file, and creating the temporary output file.
+// target is the path of the original with any symlinks resolved.
 // If output is nil, no output file was created, otherwise output is a valid file on disk
 // that needs to be cleaned up after this function exits.
-func (p *Processor) tryCog() (output string, err error) {
-	in, err := os.Open(p.File)
+func (p *Processor) tryCog(target string) (output string, err error) {
+	in, err := p.open()
 	if err != nil {
 		return "", err
 	}
@@ -106,32 +315,72 @@ func (p *Processor) tryCog() (output string, err error) {
 
 	r := bufio.NewReader(in)
 
-	output = p.File + "_cog"
-	p.tracef("Writing output to %s", output)
-	out, err := createNew(output)
+	// the output file goes next to the original so it can be renamed over it,
+	// and gets a unique name so separate runs never collide.
+	out, err := createTemp(filepath.Dir(target), outputPrefix(filepath.Base(target)))
 	if err != nil {
 		return "", err
 	}
 	defer out.Close()
+	output = out.Name()
+	p.logger().Debug("Writing output file", "output", output)
 
 	return output, p.gen(r, out)
 }
 
 // gen enacapsulates the process of generating text from an input and writing to an output.
+// If the Parallel option is set, the generators for all the blocks in the input are run
+// concurrently, and their output is assembled in the original order once they have all finished.
 func (p *Processor) gen(r *bufio.Reader, w io.Writer) error {
+	if !p.Parallel {
+		return p.genBlocks(r, w, p.generate)
+	}
+
+	a := &assembler{}
+	err := p.genBlocks(r, a, a.generator(p.generate))
+	if genErr := a.wait(); genErr != nil && (err == nil || err == io.EOF) {
+		return genErr
+	}
+	if err != io.EOF {
+		return err
+	}
+	if _, err := a.WriteTo(w); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// genBlocks reads each gocog block from the input, writing the plaintext and generator code to
+// the output and handing the generator code for each block to the given generate function.
+func (p *Processor) genBlocks(r *bufio.Reader, w io.Writer, generate generateFunc) error {
 	firstRun := true
-	for {
+	for n := 1; ; n++ {
+		start := time.Now()
 		prefix, err := p.cogPlainText(r, w, firstRun)
 		if err != nil {
 			return err
 		}
 		firstRun = false
 
-		if err := p.cogGeneratorCode(r, w, prefix); err != nil {
+		lines, err := p.cogGeneratorCode(r, w)
+		if err != nil {
 			return err
 		}
+		p.addParse(n, time.Since(start))
 
-		if err := p.cogToEnd(r, w); err != nil {
+		if !p.Excise && len(lines) > 0 {
+			if err := generate(w, lines[:len(lines)-1], prefix, n); err != nil {
+				return err
+			}
+		}
+
+		start = time.Now()
+		old, err := p.cogToEnd(r, w)
+		p.addParse(n, time.Since(start))
+		if !p.Excise {
+			p.setPrevious(n, old)
+		}
+		if err != nil {
 			return err
 		}
 	}
@@ -143,7 +392,8 @@ func (p *Processor) gen(r *bufio.Reader, w io.Writer) error {
 // Otherwise we'll write this plaintext back out to the output file as-is.
 // Any prefix before the startmark is returned so we can handle single line comment tags.
 func (p *Processor) cogPlainText(r *bufio.Reader, w io.Writer, firstRun bool) (prefix string, err error) {
-	p.tracef("cogging plaintext")
+	log := p.logger()
+	log.Debug("Reading plaintext")
 	mark := p.StartMark + "gocog"
 	lines, found, err := readUntil(r, mark)
 	if err == io.EOF {
@@ -169,7 +419,7 @@ func (p *Processor) cogPlainText(r *bufio.Reader, w io.Writer, firstRun bool) (p
 			return "", err
 		}
 	}
-	p.tracef("Wrote %v lines to output file", len(lines))
+	log.Debug("Wrote plaintext to output file", "lines", len(lines))
 
 	if !found {
 		return "", err
@@ -179,58 +429,62 @@ func (p *Processor) cogPlainText(r *bufio.Reader, w io.Writer, firstRun bool) (p
 }
 
 // Reads lines from the reader until reaching the gocog endmark
-// Writes out the generator code to a file with the given name
-// any lines that start with whitespace and then prefix will have
-// the prefix removed (this is to support single line comments)
-func (p *Processor) cogGeneratorCode(r *bufio.Reader, w io.Writer, prefix string) error {
-	p.tracef("cogging generator code")
+// and writes them out to the output file.
+// The lines read are returned so they can be used to write out the generator code.
+func (p *Processor) cogGeneratorCode(r *bufio.Reader, w io.Writer) ([]string, error) {
+	log := p.logger()
+	log.Debug("Reading generator code")
 	lines, _, err := readUntil(r, "gocog"+p.EndMark)
 	if err == io.EOF {
-		return io.ErrUnexpectedEOF
+		return nil, io.ErrUnexpectedEOF
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// we have to write this out both to the output file and to the code file that we'll be running
 	for _, line := range lines {
 		if _, err := w.Write([]byte(line)); err != nil {
-			return err
+			return nil, err
 		}
 	}
-	p.tracef("Wrote %v lines to output file", len(lines))
-
-	if !p.Excise && len(lines) > 0 {
-		if err := p.generate(w, lines[:len(lines)-1], prefix); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	log.Debug("Wrote generator code to output file", "lines", len(lines))
+	return lines, nil
 }
 
+// generateFunc is the signature of functions that produce the output for a gocog block.
+// lines is the generator code, prefix is the single line comment tag to remove from it,
+// and n is the number of the block within the file, starting at 1.
+type generateFunc func(w io.Writer, lines []string, prefix string, n int) error
+
 // generate writes out the generator code to a file and runs it.
 // If running the code doesn't return any errors, the output is written to the output file.
-// The file with the generator code is always deleted at the end of this function.
-func (p *Processor) generate(w io.Writer, lines []string, prefix string) error {
-	p.tracef("generating runnable code")
-	name := filepath.Base(p.File)
-	dir := filepath.Dir(p.File)
-	// prefix the name to ensure it starts with alphanumeric, this is required
-	// to be go-runnable.
-	name = "cog_" + name
-	gen := fmt.Sprintf("%s_cog_%s", filepath.Join(dir, name), p.Ext)
-	defer os.Remove(gen)
-
-	// write all but the last line to the generator file
-	if err := writeNewFile(gen, lines, prefix); err != nil {
+// Each block in a file gets its own generator file, which is always deleted at the end of this function.
+func (p *Processor) generate(w io.Writer, lines []string, prefix string, n int) (err error) {
+	res := BlockResult{N: n, ExitCode: -1, Start: time.Now()}
+	defer func() {
+		res.Duration = time.Since(res.Start)
+		res.Err = err
+		p.addResult(res)
+	}()
+
+	log := p.logger().With("block", n)
+	log.Debug("Writing generator file")
+	pattern := fmt.Sprintf("%s%d_*%s", generatorPrefix(filepath.Base(p.File)), n, p.Ext)
+	gen, err := writeTempFile(filepath.Dir(p.File), pattern, lines, prefix)
+	res.Timings.Write = time.Since(res.Start)
+	if err != nil {
 		return err
 	}
+	defer os.Remove(gen)
 
 	b := bytes.Buffer{}
-	if err := p.runFile(gen, &b); err != nil {
+	if err := p.runFile(gen, &b, &res, n, log); err != nil {
 		return err
 	}
+	res.Output = b.Len()
+	defer func(start time.Time) {
+		res.Timings.Output = time.Since(start)
+	}(time.Now())
 	if _, err := w.Write(b.Bytes()); err != nil {
 		return err
 	}
@@ -240,20 +494,23 @@ func (p *Processor) generate(w io.Writer, lines []string, prefix string) error {
 		if _, err := w.Write([]byte{newline}); err != nil {
 			return err
 		}
+		b.WriteByte(newline)
 	}
+	res.generated = b.Bytes()
 	return nil
 }
 
 // runFile executes the given file with the command line specified in the Processor's options.
 // If the process exits without an error, the output is written to the writer.
-func (p *Processor) runFile(f string, w io.Writer) error {
-	p.tracef("output file %v", f)
-	if p.Verbose {
+// The command line, exit code and stderr of the process are recorded in res, and any error returned
+// is a GeneratorError for block n.
+func (p *Processor) runFile(f string, w io.Writer, res *BlockResult, n int, log *slog.Logger) error {
+	if log.Enabled(context.Background(), slog.LevelDebug) {
 		contents, err := ioutil.ReadFile(f)
 		if err != nil {
 			return err
 		}
-		p.tracef("file contents:\n%s", contents)
+		log.Debug("Wrote generator file", "generator", f, "contents", string(contents))
 	}
 	cmd := p.Command
 	if strings.Contains(cmd, "%s") {
@@ -268,32 +525,61 @@ func (p *Processor) runFile(f string, w io.Writer) error {
 		}
 	}
 
-	if err := run(cmd, args, w, p.Logger); err != nil {
-		return fmt.Errorf("Error generating code from source: %s", err)
+	res.Command = append([]string{cmd}, args...)
+
+	start := time.Now()
+	p.Limit.acquire()
+	defer p.Limit.release()
+	res.Timings.Wait = time.Since(start)
+
+	if p.Watch != nil {
+		p.Watch.Started(p.File, n)
+	}
+	start = time.Now()
+	pw := &prefixWriter{w: p.Stderr, prefix: stderrPrefix(p.File, n), live: p.StreamStderr}
+	stderr, code, err := run(cmd, args, w, pw, log)
+	res.Timings.Exec = time.Since(start)
+	if p.Watch != nil {
+		p.Watch.Finished(p.File, n, err)
+	}
+	res.Stderr = string(stderr)
+	res.ExitCode = code
+	if err != nil {
+		return &GeneratorError{File: p.File, Block: n, Err: err, Stderr: res.Stderr}
 	}
 	return nil
 }
 
-// cogToEnd reads the old generateed code, up until the end tag. All but the last line is discarded.
-func (p *Processor) cogToEnd(r *bufio.Reader, w io.Writer) error {
-	p.tracef("cogging to end")
-	// we'll drop all but the COG_END line, so no need to keep them in memory
-	line, found, err := findLine(r, p.StartMark+"end"+p.EndMark)
-	if err == io.EOF && !found {
-		if !p.UseEOF {
-			return io.ErrUnexpectedEOF
+// cogToEnd reads the old generateed code, up until the end tag. All but the last line is discarded
+// from the output, and returned so it can be compared with the newly generated code.
+// Reaching the start of another block first is an error, since the block would be discarded with the output.
+func (p *Processor) cogToEnd(r *bufio.Reader, w io.Writer) (old []byte, err error) {
+	log := p.logger()
+	log.Debug("Reading old output")
+	start := p.StartMark + "gocog"
+	end := p.StartMark + "end" + p.EndMark
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if strings.Contains(line, end) {
+			if _, err := w.Write([]byte(line)); err != nil {
+				return nil, err
+			}
+			log.Debug("Wrote end marker to output file")
+			return old, err
+		}
+		if strings.Contains(line, start) {
+			return nil, errors.New("Found the start of another block before the end marker")
+		}
+		old = append(old, line...)
+		if err == io.EOF {
+			if !p.UseEOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			log.Debug("No end marker, treating end of file as end marker")
+			return old, io.EOF
 		}
-		p.tracef("No gocog end statement, treating EOF as end statement.")
-		return io.EOF
-	}
-	if err != nil && err != io.EOF {
-		return err
-	}
-
-	// if there's no error, found should always be true, so just write out
-	if _, err := w.Write([]byte(line)); err != nil {
-		return err
 	}
-	p.tracef("Wrote 1 line to output file")
-	return err
 }
@@ -4,7 +4,14 @@ import (
 	"bufio"
 	"bytes"
 	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 type CPTData struct {
@@ -81,7 +88,7 @@ func TestCogToEnd(t *testing.T) {
 		out := &bytes.Buffer{}
 
 		r := bufio.NewReader(in)
-		err := p.cogToEnd(r, out)
+		_, err := p.cogToEnd(r, out)
 
 		if err != test.err {
 			t.Errorf("CogToEnd Test %d: Expected error %v, got %v", i, test.err, err)
@@ -95,3 +102,199 @@ func TestCogToEnd(t *testing.T) {
 	}
 
 }
+
+func TestRunUnchanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "foo.txt")
+	if err := ioutil.WriteFile(file, []byte(exciseInput), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(file, &Options{StartMark: "[[[", EndMark: "]]]", Excise: true, Quiet: true})
+	if err := p.Run(); err != nil {
+		t.Fatalf("RunUnchanged: unexpected error on first run: %v", err)
+	}
+	if !p.Changed {
+		t.Errorf("RunUnchanged: first run should have changed the file")
+	}
+
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(file, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Run(); err != nil {
+		t.Fatalf("RunUnchanged: unexpected error on second run: %v", err)
+	}
+	if p.Changed {
+		t.Errorf("RunUnchanged: second run should not have changed the file")
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Errorf("RunUnchanged: Expected modification time %v, got %v", old, info.ModTime())
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("RunUnchanged: Expected only the original file to be left, got %d files", len(entries))
+	}
+}
+
+func TestRunNoCogCode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "foo.txt")
+	if err := ioutil.WriteFile(file, []byte("a\nb\n[[[end]]]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// files without gocog code shouldn't need a writable directory
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0755)
+
+	p := New(file, &Options{StartMark: "[[[", EndMark: "]]]", Quiet: true})
+	if err := p.Run(); err != NoCogCode {
+		t.Errorf("RunNoCogCode: Expected error: '%v', Got error: '%v'", NoCogCode, err)
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("RunNoCogCode: Expected only the original file, got %d files", len(entries))
+	}
+}
+
+func TestRunInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the file on disk is already up to date, but the input isn't
+	file := filepath.Join(dir, "foo.txt")
+	if err := ioutil.WriteFile(file, []byte(exciseOutput), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(file, &Options{StartMark: "[[[", EndMark: "]]]", Excise: true, Quiet: true})
+	p.Input = []byte(exciseInput)
+	if err := p.Run(); err != nil {
+		t.Fatalf("RunInput: unexpected error: %v", err)
+	}
+	if !p.Changed {
+		t.Errorf("RunInput: Expected input to be reported out of date")
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != exciseOutput {
+		t.Errorf("RunInput: file on disk was modified:\n'%s'", b)
+	}
+
+	p.Input = []byte(exciseOutput)
+	if err := p.Run(); err != nil {
+		t.Fatalf("RunInput: unexpected error: %v", err)
+	}
+	if p.Changed {
+		t.Errorf("RunInput: Expected up to date input to be reported unchanged")
+	}
+}
+
+func TestRunResults(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("generators are run with sh")
+	}
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "foo.txt")
+	input := "# [[[gocog\n# echo hello\n# echo warning >&2\n# gocog]]]\n# [[[end]]]\n" +
+		"# [[[gocog\n# echo failed >&2\n# exit 3\n# gocog]]]\n# [[[end]]]\n"
+	if err := ioutil.WriteFile(file, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(file, &Options{Command: "sh", Args: []string{"%s"}, Ext: ".sh", StartMark: "[[[", EndMark: "]]]", Quiet: true})
+	if err := p.Run(); err == nil {
+		t.Fatal("RunResults: Expected an error from the failing generator")
+	}
+	if len(p.Results) != 2 {
+		t.Fatalf("RunResults: Expected 2 results, Got %d", len(p.Results))
+	}
+
+	ok, failed := p.Results[0], p.Results[1]
+	if ok.N != 1 || ok.ExitCode != 0 || ok.Err != nil || ok.Output != len("hello\n") || ok.Stderr != "warning\n" {
+		t.Errorf("RunResults: unexpected result for first block: %+v", ok)
+	}
+	if !ok.Changed || failed.Changed {
+		t.Errorf("RunResults: Expected only the first block to be changed, Got %v and %v", ok.Changed, failed.Changed)
+	}
+	if len(ok.Command) != 2 || ok.Command[0] != "sh" {
+		t.Errorf("RunResults: unexpected command for first block: %q", ok.Command)
+	}
+	if failed.N != 2 || failed.ExitCode != 3 || failed.Err == nil || failed.Output != 0 || failed.Stderr != "failed\n" {
+		t.Errorf("RunResults: unexpected result for second block: %+v", failed)
+	}
+	if ok.Start.Before(p.Start) || ok.Timings.Exec <= 0 ||
+		ok.Timings.Write+ok.Timings.Wait+ok.Timings.Exec+ok.Timings.Output > ok.Duration {
+		t.Errorf("RunResults: unexpected timings for first block: %+v", ok.Timings)
+	}
+	if p.Duration <= 0 {
+		t.Errorf("RunResults: Expected the duration of the run to be recorded")
+	}
+}
+
+func TestRunStderrOnce(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("generators are run with sh")
+	}
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "foo.txt")
+	input := "# [[[gocog\n# echo broken >&2\n# exit 1\n# gocog]]]\n# [[[end]]]\n"
+	if err := ioutil.WriteFile(file, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, streamed := range []bool{true, false} {
+		out := &bytes.Buffer{}
+		p := New(file, &Options{Command: "sh", Args: []string{"%s"}, Ext: ".sh", StartMark: "[[[", EndMark: "]]]"})
+		p.Logger = NewLogger(out, "text", slog.LevelInfo)
+		p.Stderr = nil
+		if streamed {
+			p.Stderr = out
+		}
+		if err := p.Run(); err == nil || !strings.Contains(err.Error(), "broken") {
+			t.Errorf("RunStderrOnce: Expected the error to carry the generator's stderr, Got %v", err)
+		}
+		if n := strings.Count(out.String(), "broken"); n != 1 {
+			t.Errorf("RunStderrOnce: Expected the generator's stderr once with Stderr set %v, Got it %d times in:\n%s", streamed, n, out)
+		}
+	}
+}
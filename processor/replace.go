@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// replace replaces the file dst with the file src, giving src the permission bits of dst and,
+// if the options ask for them, its ownership and extended attributes first. Extended attributes
+// are only supported where XattrsSupported is true, and asking for them elsewhere is an error.
+// src is renamed over dst so there is never a moment where dst does not exist. If that fails
+// because they are on different filesystems, the contents of src are copied into dst instead,
+// which keeps all of dst's attributes, and src is removed.
+// If replace returns an error, src has not been removed.
+func (p *Processor) replace(src, dst string) error {
+	info, err := os.Stat(dst)
+	if err != nil {
+		return err
+	}
+
+	// changing the owner clears the setuid and setgid bits, so the mode is set after it
+	if p.PreserveOwner {
+		if err := chown(src, info); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(src, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	if p.PreserveXattrs {
+		if err := copyXattrs(dst, src); err != nil {
+			return err
+		}
+	}
+
+	err = os.Rename(src, dst)
+	if le, ok := err.(*os.LinkError); ok && le.Err == syscall.EXDEV {
+		p.logger().Debug("Cannot rename across filesystems, copying instead", "output", src, "target", dst)
+		if err := copyFile(src, dst); err != nil {
+			return err
+		}
+		return os.Remove(src)
+	}
+	return err
+}
+
+// copyFile overwrites the contents of the existing file dst with the contents of src.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
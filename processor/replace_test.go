@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+const exciseInput = "a\n// [[[gocog\n// code\n// gocog]]]\nold output\n// [[[end]]]\nb\n"
+const exciseOutput = "a\n// [[[gocog\n// code\n// gocog]]]\n// [[[end]]]\nb\n"
+
+func TestRunPreservesMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows files don't have unix permission bits")
+	}
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "script.sh")
+	if err := ioutil.WriteFile(file, []byte(exciseInput), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// the umask may have masked the mode we asked for
+	if err := os.Chmod(file, 0751); err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(file, &Options{StartMark: "[[[", EndMark: "]]]", Excise: true, Quiet: true})
+	if err := p.Run(); err != nil {
+		t.Fatalf("RunPreservesMode: unexpected error: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != exciseOutput {
+		t.Errorf("RunPreservesMode: Expected output:\n'%s'\nGot output:\n'%s'", exciseOutput, b)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0751 {
+		t.Errorf("RunPreservesMode: Expected mode %v, got %v", os.FileMode(0751), info.Mode().Perm())
+	}
+}
+
+func TestRunThroughSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks needs privileges on windows")
+	}
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "real.txt")
+	link := filepath.Join(dir, "link.txt")
+	if err := ioutil.WriteFile(file, []byte(exciseInput), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("real.txt", link); err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(link, &Options{StartMark: "[[[", EndMark: "]]]", Excise: true, Quiet: true})
+	if err := p.Run(); err != nil {
+		t.Fatalf("RunThroughSymlink: unexpected error: %v", err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("RunThroughSymlink: symlink was replaced by a regular file")
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != exciseOutput {
+		t.Errorf("RunThroughSymlink: Expected output:\n'%s'\nGot output:\n'%s'", exciseOutput, b)
+	}
+}
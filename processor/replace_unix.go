@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package processor
+
+import (
+	"os"
+	"syscall"
+)
+
+// chown gives the named file the owner and group in info.
+func chown(name string, info os.FileInfo) error {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return os.Chown(name, int(st.Uid), int(st.Gid))
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+//go:build !windows
+// +build !windows
+
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestRunPreservesOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("giving a file to another owner needs root")
+	}
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file.txt")
+	if err := ioutil.WriteFile(file, []byte(exciseInput), 0644); err != nil {
+		t.Fatal(err)
+	}
+	const uid, gid = 4321, 4322
+	if err := os.Chown(file, uid, gid); err != nil {
+		t.Fatal(err)
+	}
+	// changing the owner clears these bits, so they must be set after it
+	const mode = os.ModeSetuid | os.ModeSetgid | 0755
+	if err := os.Chmod(file, mode); err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(file, &Options{StartMark: "[[[", EndMark: "]]]", Excise: true, Quiet: true, PreserveOwner: true})
+	if err := p.Run(); err != nil {
+		t.Fatalf("RunPreservesOwner: unexpected error: %v", err)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := info.Sys().(*syscall.Stat_t)
+	if st.Uid != uid || st.Gid != gid {
+		t.Errorf("RunPreservesOwner: Expected owner %d:%d, got %d:%d", uid, gid, st.Uid, st.Gid)
+	}
+	if info.Mode() != mode {
+		t.Errorf("RunPreservesOwner: Expected mode %v, got %v", mode, info.Mode())
+	}
+}
@@ -0,0 +1,8 @@
+package processor
+
+import "os"
+
+// chown does nothing, since windows files don't have unix ownership.
+func chown(name string, info os.FileInfo) error {
+	return nil
+}
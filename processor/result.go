@@ -0,0 +1,90 @@
+package processor
+
+import (
+	"bytes"
+	"sort"
+	"time"
+)
+
+// BlockResult records what happened when the generator for a block was run.
+type BlockResult struct {
+	// N is the number of the block in the file, counting from 1.
+	N int
+	// Command is the command line that ran the generator.
+	Command []string
+	// ExitCode is the generator's exit code, or -1 if it couldn't be started or was killed.
+	ExitCode int
+	// Stderr holds what the generator wrote to stderr.
+	Stderr string
+	// Output is the number of bytes of output generated.
+	Output int
+	// Changed reports whether the output differs from the output already in the file.
+	Changed bool
+	// Start is when the block started to generate, and Duration how long it took,
+	// including writing out the generator code.
+	Start    time.Time
+	Duration time.Duration
+	// Timings breaks down where the time went.
+	Timings Timings
+	// Err is the reason the block failed, or nil if it succeeded.
+	Err error
+
+	generated []byte
+}
+
+// Timings records how long each step of generating a block took.
+type Timings struct {
+	// Parse is how long reading the block from the file took.
+	Parse time.Duration
+	// Write is how long writing out the generator code took.
+	Write time.Duration
+	// Wait is how long the generator waited for the Limit to let it run.
+	Wait time.Duration
+	// Exec is how long the generator ran.
+	Exec time.Duration
+	// Output is how long writing the generator's output took.
+	Output time.Duration
+}
+
+// addResult records the result of generating a block. Blocks may be generated concurrently.
+func (p *Processor) addResult(r BlockResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Results = append(p.Results, r)
+}
+
+// setPrevious records the output that was in the file for a block before it was generated.
+func (p *Processor) setPrevious(n int, old []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.previous == nil {
+		p.previous = map[int][]byte{}
+	}
+	p.previous[n] = old
+}
+
+// addParse adds d to the time spent reading block n from the file.
+func (p *Processor) addParse(n int, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.parsed == nil {
+		p.parsed = map[int]time.Duration{}
+	}
+	p.parsed[n] += d
+}
+
+// finishResults puts the results in the order of the blocks in the file, once all
+// the generators have finished, and compares the output of each with what was in the file.
+func (p *Processor) finishResults() {
+	sort.Slice(p.Results, func(i, j int) bool { return p.Results[i].N < p.Results[j].N })
+	for i := range p.Results {
+		r := &p.Results[i]
+		if r.Err == nil {
+			r.Changed = !bytes.Equal(r.generated, p.previous[r.N])
+		}
+		r.Timings.Parse = p.parsed[r.N]
+		r.generated = nil
+	}
+	p.previous = nil
+	p.parsed = nil
+}
@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// stderrMu keeps the lines that concurrent generators write to stderr whole.
+var stderrMu sync.Mutex
+
+// GeneratorError is the error returned by Run when a block's generator fails.
+// Its message includes what the generator wrote to stderr.
+type GeneratorError struct {
+	// File is the file being processed, and Block the number of the block in it, counting from 1.
+	File  string
+	Block int
+	// Err is the reason the generator failed, such as its exit status.
+	Err error
+	// Stderr holds what the generator wrote to stderr.
+	Stderr string
+}
+
+// Error returns the reason the generator failed, followed by its stderr, each line
+// prefixed with the file and block as file:block:.
+func (e *GeneratorError) Error() string {
+	msg := fmt.Sprintf("Error generating code from source in block %d of '%s': %s", e.Block, e.File, e.Err)
+	if e.Stderr == "" {
+		return msg
+	}
+	b := &bytes.Buffer{}
+	writeLines(b, stderrPrefix(e.File, e.Block), []byte(strings.TrimSuffix(e.Stderr, "\n")+"\n"))
+	return msg + "\n" + strings.TrimSuffix(b.String(), "\n")
+}
+
+// Unwrap returns the reason the generator failed.
+func (e *GeneratorError) Unwrap() error {
+	return e.Err
+}
+
+// stderrPrefix returns the prefix of the lines of the stderr of a block's generator.
+func stderrPrefix(file string, n int) string {
+	return fmt.Sprintf("%s:%d: ", file, n)
+}
+
+// prefixWriter writes the stderr of a generator to w, with each line prefixed. If live is set,
+// each line is written as soon as it's complete, otherwise all the lines are written together
+// when the generator has finished and Flush is called, so they aren't split up by other generators'.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	live   bool
+	buf    []byte
+}
+
+// Write writes any lines completed by b if the writer is live, and holds on to the rest.
+func (pw *prefixWriter) Write(b []byte) (int, error) {
+	pw.buf = append(pw.buf, b...)
+	if pw.live {
+		if i := bytes.LastIndexByte(pw.buf, '\n'); i >= 0 {
+			pw.write(pw.buf[:i+1])
+			pw.buf = pw.buf[i+1:]
+		}
+	}
+	return len(b), nil
+}
+
+// Flush writes all the lines held on to, ending the last with a newline if it has none.
+func (pw *prefixWriter) Flush() {
+	if len(pw.buf) == 0 {
+		return
+	}
+	if pw.buf[len(pw.buf)-1] != newline {
+		pw.buf = append(pw.buf, newline)
+	}
+	pw.write(pw.buf)
+	pw.buf = nil
+}
+
+// write writes the lines to w, if there's anywhere to write them.
+func (pw *prefixWriter) write(lines []byte) {
+	if pw.w == nil {
+		return
+	}
+	stderrMu.Lock()
+	defer stderrMu.Unlock()
+	writeLines(pw.w, pw.prefix, lines)
+}
+
+// writeLines writes each line in lines, which must end with a newline, to w, prefixed.
+// What stderr is written to is of no concern to the generators, so errors are ignored.
+func writeLines(w io.Writer, prefix string, lines []byte) {
+	b := make([]byte, 0, len(lines)+len(prefix)*bytes.Count(lines, []byte{newline}))
+	for len(lines) > 0 {
+		i := bytes.IndexByte(lines, newline)
+		b = append(b, prefix...)
+		b = append(b, lines[:i+1]...)
+		lines = lines[i+1:]
+	}
+	w.Write(b)
+}
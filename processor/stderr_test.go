@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type PrefixWriterData struct {
+	writes []string
+	live   bool
+	// what's been written after each write, and after Flush
+	written []string
+	flushed string
+}
+
+func TestPrefixWriter(t *testing.T) {
+	tests := []PrefixWriterData{
+		{[]string{"a\n", "b\n"}, false, []string{"", ""}, "f:1: a\nf:1: b\n"},
+		{[]string{"a\n", "b\n"}, true, []string{"f:1: a\n", "f:1: a\nf:1: b\n"}, "f:1: a\nf:1: b\n"},
+		{[]string{"a", "b\nc", "\n"}, true, []string{"", "f:1: ab\n", "f:1: ab\nf:1: c\n"}, "f:1: ab\nf:1: c\n"},
+		{[]string{"a\nb"}, true, []string{"f:1: a\n"}, "f:1: a\nf:1: b\n"},
+		{[]string{"a\nb"}, false, []string{""}, "f:1: a\nf:1: b\n"},
+		{[]string{}, false, []string{}, ""},
+	}
+
+	for i, test := range tests {
+		out := &bytes.Buffer{}
+		pw := &prefixWriter{w: out, prefix: "f:1: ", live: test.live}
+		for j, s := range test.writes {
+			if n, err := pw.Write([]byte(s)); n != len(s) || err != nil {
+				t.Errorf("PrefixWriter Test %d: Expected write of %d bytes, Got %d, %v", i, len(s), n, err)
+			}
+			if out.String() != test.written[j] {
+				t.Errorf("PrefixWriter Test %d: Expected %q after write %d, Got %q", i, test.written[j], j, out.String())
+			}
+		}
+		pw.Flush()
+		if out.String() != test.flushed {
+			t.Errorf("PrefixWriter Test %d: Expected %q after flush, Got %q", i, test.flushed, out.String())
+		}
+	}
+
+	// without a writer, the lines are dropped
+	pw := &prefixWriter{prefix: "f:1: ", live: true}
+	pw.Write([]byte("a\nb"))
+	pw.Flush()
+}
+
+type GeneratorErrorData struct {
+	stderr string
+	msg    string
+}
+
+func TestGeneratorError(t *testing.T) {
+	fail := errors.New("exit status 1")
+	tests := []GeneratorErrorData{
+		{"", "Error generating code from source in block 2 of 'foo.txt': exit status 1"},
+		{"oops\n", "Error generating code from source in block 2 of 'foo.txt': exit status 1\nfoo.txt:2: oops"},
+		{"oops\nagain", "Error generating code from source in block 2 of 'foo.txt': exit status 1\nfoo.txt:2: oops\nfoo.txt:2: again"},
+	}
+
+	for i, test := range tests {
+		err := &GeneratorError{File: "foo.txt", Block: 2, Err: fail, Stderr: test.stderr}
+		if err.Error() != test.msg {
+			t.Errorf("GeneratorError Test %d: Expected %q, Got %q", i, test.msg, err.Error())
+		}
+		if !errors.Is(err, fail) {
+			t.Errorf("GeneratorError Test %d: Expected error to wrap %v", i, fail)
+		}
+	}
+}
@@ -5,37 +5,45 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"math/rand"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"unicode"
 )
 
-// run executes the command with the given arguments, writing output to the given writer and errors to the logger.
-func run(cmd string, args []string, stdout io.Writer, errLog *log.Logger) error {
-	errLog.Printf("running %q", append([]string{cmd}, args...))
+// run executes the command with the given arguments, writing output to the given writer and errors to stderr.
+// It returns what the command wrote to stderr and its exit code, which is -1 if it couldn't be started or was killed.
+func run(cmd string, args []string, stdout io.Writer, stderr *prefixWriter, log *slog.Logger) ([]byte, int, error) {
+	log.Debug("Running generator", "command", append([]string{cmd}, args...))
 	errOut := bytes.Buffer{}
 	c := exec.Command(cmd, args...)
 	c.Stdout = stdout
-	c.Stderr = &errOut
+	c.Stderr = io.MultiWriter(&errOut, stderr)
 
 	err := c.Run()
-	if errOut.Len() > 0 {
-		errLog.Printf("%s", errOut.String())
+	stderr.Flush()
+	code := -1
+	if c.ProcessState != nil {
+		code = c.ProcessState.ExitCode()
 	}
-	return err
+	return errOut.Bytes(), code, err
 }
 
-// writeNewFile creates a new file and writes the lines to the file, stripping out the prefix if it exists.
-// This will return an error if the file already exists, or if there are any errors during creation.
+// writeTempFile creates a new file in dir with a unique name built from pattern, as with createTemp,
+// and writes the lines to the file, stripping out the prefix if it exists.
+// The name of the file is returned. If there are any errors, the file is removed.
 // the prefix will be removed if it is the first non-whitespace text in any line
-func writeNewFile(name string, lines []string, prefix string) error {
-	out, err := createNew(name)
+func writeTempFile(dir, pattern string, lines []string, prefix string) (string, error) {
+	out, err := createTemp(dir, pattern)
 	if err != nil {
-		return err
+		return "", err
 	}
+	name := out.Name()
 
 	var reg *regexp.Regexp
 	if len(prefix) > 0 {
@@ -47,17 +55,19 @@ func writeNewFile(name string, lines []string, prefix string) error {
 			line = reg.ReplaceAllString(line, fmt.Sprintf(`$1`))
 		}
 		if _, err := out.Write([]byte(line)); err != nil {
+			defer os.Remove(name)
 			if err2 := out.Close(); err2 != nil {
-				return fmt.Errorf("Error writing to and closing newfile %s: %s%s", name, err, err2)
+				return "", fmt.Errorf("Error writing to and closing newfile %s: %s%s", name, err, err2)
 			}
-			return fmt.Errorf("Error writing to newfile %s: %s", name, err)
+			return "", fmt.Errorf("Error writing to newfile %s: %s", name, err)
 		}
 	}
 
 	if err := out.Close(); err != nil {
-		return fmt.Errorf("Error closing newfile %s: %s", name, err)
+		os.Remove(name)
+		return "", fmt.Errorf("Error closing newfile %s: %s", name, err)
 	}
-	return nil
+	return name, nil
 }
 
 // readUntil reads and returns lines from a reader until the marker is found.
@@ -89,13 +99,91 @@ func findLine(r *bufio.Reader, marker string) (line string, found bool, err erro
 	return "", false, err
 }
 
-// createNew creates a new file with the given name, returning an error if the file already exists.
-func createNew(filename string) (*os.File, error) {
-	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
-	if os.IsExist(err) {
-		return f, fmt.Errorf("File '%s' already exists.", filename)
+// containsLine reports whether any line read from r contains the marker,
+// without keeping more than a line in memory.
+func containsLine(r *bufio.Reader, marker string) (bool, error) {
+	_, found, err := findLine(r, marker)
+	if err == io.EOF {
+		err = nil
 	}
-	return f, err
+	return found, err
+}
+
+// sameContents reports whether the two named files have identical contents.
+func sameContents(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	ia, err := fa.Stat()
+	if err != nil {
+		return false, err
+	}
+	ib, err := fb.Stat()
+	if err != nil {
+		return false, err
+	}
+	if ia.Size() != ib.Size() {
+		return false, nil
+	}
+
+	ra, rb := bufio.NewReader(fa), bufio.NewReader(fb)
+	for {
+		ca, errA := ra.ReadByte()
+		cb, errB := rb.ReadByte()
+		if errA == io.EOF && errB == io.EOF {
+			return true, nil
+		}
+		if errA != nil && errA != io.EOF {
+			return false, errA
+		}
+		if errB != nil && errB != io.EOF {
+			return false, errB
+		}
+		if ca != cb || errA != errB {
+			return false, nil
+		}
+	}
+}
+
+// tempRandLen is the number of random hex digits in the names of temporary files.
+const tempRandLen = 8
+
+// createTemp creates a new file in dir for reading and writing, as ioutil.TempFile does, with
+// a name made by replacing the last * in pattern with tempRandLen random hex digits, or appending
+// them if there is no *. Unlike ioutil.TempFile, the random part always has the same form,
+// so FindLeftovers can tell gocog's temporary files apart from other files with similar names.
+func createTemp(dir, pattern string) (*os.File, error) {
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	for try := 0; ; try++ {
+		name := filepath.Join(dir, fmt.Sprintf("%s%0*x%s", prefix, tempRandLen, rand.Uint32(), suffix))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) && try < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// outputPrefix returns the prefix of the names of temporary output files for the file with the given base name.
+func outputPrefix(name string) string {
+	return name + "_cog_"
+}
+
+// generatorPrefix returns the prefix of the names of generator files for the file with the given base name.
+// The name starts with alphanumerics, since this is required to be go-runnable.
+func generatorPrefix(name string) string {
+	return "cog_" + name + "_cog_"
 }
 
 // getPrefix returns all the text before the given mark in the line with leftmost whitespace removed.
@@ -105,3 +193,61 @@ func getPrefix(line, mark string) string {
 	}
 	return ""
 }
+
+// assembler collects output in its original order while the generators for each block run concurrently.
+// Writes go to the text following the most recently started generator.
+type assembler struct {
+	pieces []*bytes.Buffer
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	err    error
+}
+
+// Write appends b to the text after the last generator started.
+func (a *assembler) Write(b []byte) (int, error) {
+	if len(a.pieces) == 0 {
+		a.pieces = append(a.pieces, &bytes.Buffer{})
+	}
+	return a.pieces[len(a.pieces)-1].Write(b)
+}
+
+// generator returns a generateFunc that runs gen in the background, reserving
+// a place for its output at the current position.
+func (a *assembler) generator(gen generateFunc) generateFunc {
+	return func(_ io.Writer, lines []string, prefix string, n int) error {
+		out := &bytes.Buffer{}
+		a.pieces = append(a.pieces, out, &bytes.Buffer{})
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			if err := gen(out, lines, prefix, n); err != nil {
+				a.mu.Lock()
+				if a.err == nil {
+					a.err = err
+				}
+				a.mu.Unlock()
+			}
+		}()
+		return nil
+	}
+}
+
+// wait blocks until all generators have finished, and returns the first error any of them returned.
+func (a *assembler) wait() error {
+	a.wg.Wait()
+	return a.err
+}
+
+// WriteTo writes all the collected output to w, in order.
+// It must not be called before wait has returned.
+func (a *assembler) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, b := range a.pieces {
+		n, err := b.WriteTo(w)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -3,8 +3,14 @@ package processor
 import (
 	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 type ReadUntilData struct {
@@ -111,3 +117,89 @@ func TestGetPrefix(t *testing.T) {
 		}
 	}
 }
+
+func TestAssembler(t *testing.T) {
+	a := &assembler{}
+	// later blocks finish first, so output must not depend on completion order
+	gen := a.generator(func(w io.Writer, lines []string, prefix string, n int) error {
+		time.Sleep(time.Duration(4-n) * 10 * time.Millisecond)
+		fmt.Fprintf(w, "out%d\n", n)
+		return nil
+	})
+
+	a.Write([]byte("start\n"))
+	for n := 1; n <= 3; n++ {
+		fmt.Fprintf(a, "code%d\n", n)
+		if err := gen(nil, nil, "", n); err != nil {
+			t.Fatalf("Assembler: unexpected error starting generator %d: %v", n, err)
+		}
+		fmt.Fprintf(a, "end%d\n", n)
+	}
+	if err := a.wait(); err != nil {
+		t.Fatalf("Assembler: unexpected error: %v", err)
+	}
+
+	expected := "start\ncode1\nout1\nend1\ncode2\nout2\nend2\ncode3\nout3\nend3\n"
+	out := &bytes.Buffer{}
+	a.WriteTo(out)
+	if out.String() != expected {
+		t.Errorf("Assembler: Expected output:\n'%s'\nGot output:\n'%s'", expected, out.String())
+	}
+}
+
+func TestAssemblerError(t *testing.T) {
+	a := &assembler{}
+	fail := errors.New("fail")
+	gen := a.generator(func(w io.Writer, lines []string, prefix string, n int) error {
+		if n == 2 {
+			return fail
+		}
+		return nil
+	})
+	for n := 1; n <= 3; n++ {
+		gen(nil, nil, "", n)
+	}
+	if err := a.wait(); err != fail {
+		t.Errorf("AssemblerError: Expected error: '%v', Got error: '%v'", fail, err)
+	}
+}
+
+type SameContentsData struct {
+	a    string
+	b    string
+	same bool
+}
+
+func TestSameContents(t *testing.T) {
+	tests := []SameContentsData{
+		{"", "", true},
+		{"abc\n", "abc\n", true},
+		{"abc\n", "abd\n", false},
+		{"abc", "abc\n", false},
+		{"abc\n", "", false},
+	}
+
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a")
+	b := filepath.Join(dir, "b")
+
+	for i, test := range tests {
+		if err := ioutil.WriteFile(a, []byte(test.a), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(b, []byte(test.b), 0644); err != nil {
+			t.Fatal(err)
+		}
+		same, err := sameContents(a, b)
+		if err != nil {
+			t.Errorf("SameContents Test %d: unexpected error: %v", i, err)
+		}
+		if same != test.same {
+			t.Errorf("SameContents Test %d: Expected %v, got %v", i, test.same, same)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package processor
+
+// Watcher is told when each generator starts and finishes running, for instance to show
+// progress. It may be shared between Processors, so its methods may be called concurrently.
+type Watcher interface {
+	// Started is called when the generator for block n of the file starts running.
+	Started(file string, n int)
+	// Finished is called when the generator for block n of the file has finished,
+	// with the error it failed with, if any.
+	Finished(file string, n int, err error)
+}
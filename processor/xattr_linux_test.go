@@ -0,0 +1,49 @@
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestRunPreservesXattrs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file.txt")
+	if err := ioutil.WriteFile(file, []byte(exciseInput), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Setxattr(file, "user.gocog", []byte("kept"), 0); err != nil {
+		if err == syscall.ENOTSUP || err == syscall.EPERM {
+			t.Skipf("filesystem doesn't support user xattrs: %v", err)
+		}
+		t.Fatal(err)
+	}
+
+	p := New(file, &Options{StartMark: "[[[", EndMark: "]]]", Excise: true, Quiet: true, PreserveXattrs: true})
+	if err := p.Run(); err != nil {
+		t.Fatalf("RunPreservesXattrs: unexpected error: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != exciseOutput {
+		t.Errorf("RunPreservesXattrs: Expected output:\n'%s'\nGot output:\n'%s'", exciseOutput, b)
+	}
+	value := make([]byte, 64)
+	size, err := syscall.Getxattr(file, "user.gocog", value)
+	if err != nil {
+		t.Fatalf("RunPreservesXattrs: xattr was not preserved: %v", err)
+	}
+	if string(value[:size]) != "kept" {
+		t.Errorf("RunPreservesXattrs: Expected xattr value 'kept', got '%s'", value[:size])
+	}
+}
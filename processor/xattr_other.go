@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !freebsd && !netbsd
+// +build !linux,!darwin,!freebsd,!netbsd
+
+package processor
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// XattrsSupported reports whether the PreserveXattrs option is supported on this OS.
+const XattrsSupported = false
+
+// copyXattrs returns an error, since extended attributes aren't supported on this OS.
+func copyXattrs(src, dst string) error {
+	return fmt.Errorf("Extended attributes are not supported on %s", runtime.GOOS)
+}
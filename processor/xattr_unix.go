@@ -0,0 +1,56 @@
+//go:build linux || darwin || freebsd || netbsd
+// +build linux darwin freebsd netbsd
+
+package processor
+
+import (
+	"bytes"
+	"golang.org/x/sys/unix"
+)
+
+// XattrsSupported reports whether the PreserveXattrs option is supported on this OS.
+const XattrsSupported = true
+
+// copyXattrs copies the extended attributes of the file src to the file dst.
+func copyXattrs(src, dst string) error {
+	names, err := listXattrs(src)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		size, err := unix.Getxattr(src, name, nil)
+		if err != nil {
+			return err
+		}
+		value := make([]byte, size)
+		if size, err = unix.Getxattr(src, name, value); err != nil {
+			return err
+		}
+		if err := unix.Setxattr(dst, name, value[:size], 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listXattrs returns the names of the extended attributes of the named file.
+func listXattrs(name string) ([]string, error) {
+	size, err := unix.Listxattr(name, nil)
+	if err != nil || size == 0 {
+		if err == unix.ENOTSUP {
+			err = nil
+		}
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Listxattr(name, buf); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"github.com/natefinch/gocog/processor"
+	"golang.org/x/term"
+	"golang.org/x/text/width"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// progressInterval is how often the status line is redrawn while nothing else is written.
+const progressInterval = 100 * time.Millisecond
+
+// progress shows how far a run has got on a terminal: the files done out of the total, the
+// generators running and the files that failed so far, on a status line redrawn as they change.
+// Log messages and generator stderr are written through it, so they appear above the status line.
+// A nil progress shows nothing.
+type progress struct {
+	term    io.Writer  // where the status line is drawn
+	out     io.Writer  // where messages written through it go
+	width   func() int // the width of the terminal, in columns
+	restore func()     // puts the terminal back as it was before the progress was drawn
+
+	mu                  sync.Mutex
+	total, done, failed int
+	running             []string // the generators running, as file:block, in the order they started
+	shown               string   // the status line on the terminal
+	stop                chan struct{}
+	stopped             sync.WaitGroup
+}
+
+// newProgress returns the progress of processing the files, drawn on stdout if it's a terminal,
+// or nil if it isn't, or the options turn progress off, in which case each file is logged instead.
+// The processors' log messages about each file are replaced by the progress, but warnings and
+// errors are still logged, through the progress.
+func newProgress(procs []*processor.Processor, opts *options) *progress {
+	if opts.Quiet || opts.NoProgress || !isTerminal(os.Stdout) {
+		return nil
+	}
+	restore, ok := enableEscapes(os.Stdout)
+	if !ok {
+		return nil
+	}
+	width := func() int { return termWidth(os.Stdout) }
+	pr := &progress{term: os.Stdout, out: os.Stderr, width: width, restore: restore, total: len(procs), stop: make(chan struct{})}
+	for _, p := range procs {
+		level := p.LogLevel()
+		if level == slog.LevelInfo {
+			level = slog.LevelWarn
+		}
+		p.Logger = processor.NewLogger(pr, opts.LogFormat, level)
+		if p.Stderr != nil {
+			p.Stderr = pr
+		}
+		p.Watch = pr
+	}
+
+	pr.stopped.Add(1)
+	go pr.tick()
+	return pr
+}
+
+// isTerminal reports whether the file is a terminal. Other character devices, such as
+// /dev/null or NUL on windows, are not.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// termWidth returns the width of the terminal f in columns. If the terminal can't say,
+// the COLUMNS environment variable is used, or failing that, a conservative 80.
+func termWidth(f *os.File) int {
+	if width, _, err := term.GetSize(int(f.Fd())); err == nil && width > 0 {
+		return width
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return 80
+}
+
+// tick redraws the status line until the progress is finished.
+func (pr *progress) tick() {
+	defer pr.stopped.Done()
+	t := time.NewTicker(progressInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-pr.stop:
+			return
+		case <-t.C:
+			pr.mu.Lock()
+			pr.draw()
+			pr.mu.Unlock()
+		}
+	}
+}
+
+// Finish stops drawing the status line and clears it, leaving the terminal for what follows.
+func (pr *progress) Finish() {
+	if pr == nil {
+		return
+	}
+	close(pr.stop)
+	pr.stopped.Wait()
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.clear()
+	pr.restore()
+}
+
+// Done records that a file has been processed, with the error it returned.
+func (pr *progress) Done(err error) {
+	if pr == nil {
+		return
+	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.done++
+	if err != nil && err != processor.NoCogCode {
+		pr.failed++
+	}
+}
+
+// Started records that a generator has started running.
+func (pr *progress) Started(file string, n int) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.running = append(pr.running, fmt.Sprintf("%s:%d", file, n))
+}
+
+// Finished records that a generator has finished running.
+func (pr *progress) Finished(file string, n int, err error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	name := fmt.Sprintf("%s:%d", file, n)
+	for i, r := range pr.running {
+		if r == name {
+			pr.running = append(pr.running[:i], pr.running[i+1:]...)
+			break
+		}
+	}
+}
+
+// Write writes b above the status line.
+func (pr *progress) Write(b []byte) (int, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.clear()
+	n, err := pr.out.Write(b)
+	pr.draw()
+	return n, err
+}
+
+// status returns the status line, cut to fit within the width of the terminal, which is
+// measured each time so the line follows the terminal as it's resized.
+func (pr *progress) status() string {
+	s := fmt.Sprintf("gocog: %d/%d files", pr.done, pr.total)
+	if pr.failed > 0 {
+		s += fmt.Sprintf(", %d failed", pr.failed)
+	}
+	if len(pr.running) > 0 {
+		s += ", running " + strings.Join(pr.running, " ")
+	}
+	// a line that fills the last column wraps on some terminals, and \r\x1b[K only clears
+	// the last row of a wrapped line, so leave that column empty
+	return truncate(printable(s), pr.width()-1)
+}
+
+// printable replaces the control characters in s, which could move the cursor, with ?.
+func printable(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// truncate cuts s to at most width columns on a terminal, ending it with ... if it's cut.
+func truncate(s string, width int) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+	if width < 3 {
+		return ""
+	}
+	cols := 0
+	for i, r := range s {
+		if cols+runeWidth(r) > width-3 {
+			return s[:i] + "..."
+		}
+		cols += runeWidth(r)
+	}
+	return s
+}
+
+// displayWidth returns the number of columns s takes up on a terminal.
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// runeWidth returns the number of columns r takes up on a terminal: none for combining
+// marks and other zero width characters, two for wide and fullwidth East Asian characters,
+// including emoji, and one for anything else.
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// draw redraws the status line if it has changed.
+func (pr *progress) draw() {
+	s := pr.status()
+	if s == pr.shown {
+		return
+	}
+	fmt.Fprintf(pr.term, "\r\x1b[K%s", s)
+	pr.shown = s
+}
+
+// clear erases the status line.
+func (pr *progress) clear() {
+	if pr.shown != "" {
+		fmt.Fprint(pr.term, "\r\x1b[K")
+		pr.shown = ""
+	}
+}
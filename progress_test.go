@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type TruncateData struct {
+	s         string
+	width     int
+	truncated string
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []TruncateData{
+		{"hello", 10, "hello"},
+		{"hello", 5, "hello"},
+		{"hello world", 8, "hello..."},
+		{"hello", 2, ""},
+		// wide characters take two columns, and are never split
+		{"日本語のファイル", 16, "日本語のファイル"},
+		{"日本語のファイル", 10, "日本語..."},
+		{"日本語のファイル", 9, "日本語..."},
+		// combining marks take none
+		{"café café", 9, "café café"},
+		{"café café", 7, "café..."},
+	}
+
+	for i, test := range tests {
+		truncated := truncate(test.s, test.width)
+		if truncated != test.truncated {
+			t.Errorf("Truncate Test %d: Expected %q, Got %q", i, test.truncated, truncated)
+		}
+		if w := displayWidth(truncated); w > test.width {
+			t.Errorf("Truncate Test %d: %q is %d columns wide, more than %d", i, truncated, w, test.width)
+		}
+	}
+}
+
+// newTestProgress returns a progress drawing to a buffer, as on a terminal of the given width.
+func newTestProgress(width int) (*progress, *bytes.Buffer) {
+	b := &bytes.Buffer{}
+	return &progress{term: b, out: b, width: func() int { return width }, restore: func() {}, total: 3}, b
+}
+
+func TestProgressStatus(t *testing.T) {
+	pr, _ := newTestProgress(80)
+	if s := pr.status(); s != "gocog: 0/3 files" {
+		t.Errorf("ProgressStatus: Expected the files done, Got %q", s)
+	}
+
+	pr.Started("a.go", 1)
+	pr.Started("b\n.go", 2)
+	pr.Done(nil)
+	pr.Done(errors.New("failed"))
+	if s, expected := pr.status(), "gocog: 2/3 files, 1 failed, running a.go:1 b?.go:2"; s != expected {
+		t.Errorf("ProgressStatus: Expected %q, Got %q", expected, s)
+	}
+
+	pr.Finished("a.go", 1, nil)
+	pr.width = func() int { return 30 }
+	// the last column is left empty, so the line can't wrap
+	if s, expected := pr.status(), "gocog: 2/3 files, 1 failed..."; s != expected {
+		t.Errorf("ProgressStatus: Expected %q, Got %q", expected, s)
+	}
+}
+
+func TestProgressWrite(t *testing.T) {
+	pr, b := newTestProgress(80)
+
+	pr.Write([]byte("first\n"))
+	if expected := "first\n\r\x1b[Kgocog: 0/3 files"; b.String() != expected {
+		t.Errorf("ProgressWrite: Expected %q, Got %q", expected, b.String())
+	}
+
+	// the status line is cleared before writing, and drawn again after
+	b.Reset()
+	pr.Done(nil)
+	pr.Write([]byte("second\n"))
+	if expected := "\r\x1b[Ksecond\n\r\x1b[Kgocog: 1/3 files"; b.String() != expected {
+		t.Errorf("ProgressWrite: Expected %q, Got %q", expected, b.String())
+	}
+
+	// an unchanged status line isn't drawn again
+	b.Reset()
+	pr.mu.Lock()
+	pr.draw()
+	pr.mu.Unlock()
+	if b.Len() != 0 {
+		t.Errorf("ProgressWrite: Expected nothing drawn for an unchanged status, Got %q", b.String())
+	}
+
+	restored := false
+	pr.restore = func() { restored = true }
+	pr.stop = make(chan struct{})
+	pr.Finish()
+	if expected := "\r\x1b[K"; b.String() != expected || !restored {
+		t.Errorf("ProgressWrite: Expected Finish to clear the status line and restore the terminal, Got %q, %v", b.String(), restored)
+	}
+}
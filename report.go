@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/natefinch/gocog/processor"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// reportFormats writes a run report in each format that can be given to --report.
+var reportFormats = map[string]func(w io.Writer, r *runReport) error{
+	"json":  writeJSONReport,
+	"junit": writeJUnitReport,
+	"sarif": writeSARIFReport,
+}
+
+// runReport is the report of a run over many files, as written by --report.
+// Durations are in seconds.
+type runReport struct {
+	Files    []fileReport `json:"files"`
+	Duration float64      `json:"duration"`
+}
+
+// fileReport is the part of a run report about a single file.
+type fileReport struct {
+	File     string        `json:"file"`
+	Status   string        `json:"status"`
+	Changed  bool          `json:"changed"`
+	Duration float64       `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	Diff     string        `json:"diff,omitempty"`
+	Blocks   []blockReport `json:"blocks"`
+	Findings []finding     `json:"findings,omitempty"`
+}
+
+// blockReport is the part of a run report about a single block, from the result of running its generator.
+// Line and EndLine are the lines of its start and end marks in the file as it is after the run, where
+// EndLine is 0 if the block runs to the end of the file, and both are 0 if the markers couldn't be read.
+type blockReport struct {
+	Block    int      `json:"block"`
+	Line     int      `json:"line,omitempty"`
+	EndLine  int      `json:"end_line,omitempty"`
+	Status   string   `json:"status"`
+	Duration float64  `json:"duration"`
+	Command  []string `json:"command"`
+	ExitCode int      `json:"exit_code"`
+	Stderr   string   `json:"stderr"`
+	Bytes    int      `json:"bytes"`
+	Changed  bool     `json:"changed"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// finding is a problem found in a file, from its markers or because its output is out of date.
+type finding struct {
+	Rule    string `json:"rule"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	EndLine int    `json:"end_line"`
+}
+
+// newReport creates the report of a run from the processors and the error each returned,
+// and how long the whole run took.
+func newReport(procs []*processor.Processor, errs []error, elapsed time.Duration) *runReport {
+	r := &runReport{Files: make([]fileReport, 0, len(procs)), Duration: elapsed.Seconds()}
+	for i, p := range procs {
+		f := fileReport{
+			File:     p.File,
+			Status:   fileStatus(p, errs[i]),
+			Changed:  p.Changed,
+			Duration: p.Duration.Seconds(),
+			Diff:     string(p.Diff),
+			Blocks:   make([]blockReport, 0, len(p.Results)),
+		}
+		if errs[i] != nil && errs[i] != processor.NoCogCode {
+			f.Error = errs[i].Error()
+		}
+		lines := map[int]processor.Block{}
+		if len(p.Results) > 0 {
+			blocks, _ := p.Blocks()
+			for _, b := range blocks {
+				lines[b.N] = b
+			}
+		}
+		for _, res := range p.Results {
+			b := blockReport{
+				Block:    res.N,
+				Line:     lines[res.N].Start,
+				EndLine:  lines[res.N].End,
+				Status:   "ok",
+				Duration: res.Duration.Seconds(),
+				Command:  res.Command,
+				ExitCode: res.ExitCode,
+				Stderr:   res.Stderr,
+				Bytes:    res.Output,
+				Changed:  res.Changed,
+			}
+			if res.Err != nil {
+				b.Status = "failed"
+				// the stderr the error carries is already in the record
+				b.Error = strings.SplitN(res.Err.Error(), "\n", 2)[0]
+			}
+			f.Blocks = append(f.Blocks, b)
+		}
+		f.Findings = findings(p, f.Status)
+		r.Files = append(r.Files, f)
+	}
+	return r
+}
+
+// findings returns the problems with the markers in the processor's file, and if its status is stale,
+// the blocks whose output is out of date.
+func findings(p *processor.Processor, status string) []finding {
+	if status == "no-cog-code" {
+		return nil
+	}
+	var found []finding
+	lint, err := p.Lint()
+	if err != nil {
+		return nil
+	}
+	for _, f := range lint {
+		found = append(found, newFinding(f))
+	}
+	if status != "stale" {
+		return found
+	}
+
+	blocks, err := p.Blocks()
+	if err != nil {
+		return found
+	}
+	changed := map[int]bool{}
+	for _, res := range p.Results {
+		changed[res.N] = res.Changed
+	}
+	for _, b := range blocks {
+		// when the generators weren't run, as with excise, any block with output is out of date
+		if changed[b.N] || (len(p.Results) == 0 && b.Output > 0) {
+			end := b.End
+			if end == 0 {
+				end = b.Start
+			}
+			msg := fmt.Sprintf("The generated output of block %d is out of date", b.N)
+			found = append(found, newFinding(processor.Finding{Rule: processor.StaleOutput, Message: msg, Line: b.Start, EndLine: end}))
+		}
+	}
+	return found
+}
+
+// newFinding returns the finding for the report, with the level of the rule it breaks.
+func newFinding(f processor.Finding) finding {
+	level := "error"
+	if processor.Rules[f.Rule].Warning {
+		level = "warning"
+	}
+	return finding{f.Rule, level, f.Message, f.Line, f.Column, f.EndLine}
+}
+
+// fileStatus describes what happened to the processor's file: it was updated, was unchanged,
+// is stale (out of date, but not written), has no gocog code, or failed with an error.
+func fileStatus(p *processor.Processor, err error) string {
+	switch {
+	case err == processor.NoCogCode:
+		return "no-cog-code"
+	case err != nil:
+		return "error"
+	case p.Changed && (p.DryRun || p.Check || p.Input != nil):
+		return "stale"
+	case p.Changed:
+		return "updated"
+	}
+	return "unchanged"
+}
+
+// writeReport writes the report in the given format to the named file, or to stdout if name is empty.
+func writeReport(format, name string, r *runReport) error {
+	if name == "" {
+		return reportFormats[format](os.Stdout, r)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := reportFormats[format](f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeJSONReport writes the report as indented JSON.
+func writeJSONReport(w io.Writer, r *runReport) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/natefinch/gocog/processor"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+// shOptions are the options for running generators written in sh.
+func shOptions() *processor.Options {
+	return &processor.Options{Command: "sh", Args: []string{"%s"}, Ext: ".sh", StartMark: "[[[", EndMark: "]]]", Quiet: true}
+}
+
+func TestNewReport(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("generators are run with sh")
+	}
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"updated.txt":   "# [[[gocog\n# echo hello\n# gocog]]]\n# [[[end]]]\n",
+		"unchanged.txt": "# [[[gocog\n# echo hello\n# gocog]]]\nhello\n# [[[end]]]\n",
+		"stale.txt":     "# [[[gocog\n# echo hello\n# gocog]]]\n# [[[end]]]\n",
+		"none.txt":      "nothing to see\n",
+		"failed.txt":    "# [[[gocog\n# echo oops >&2\n# exit 3\n# gocog]]]\n# [[[end]]]\n",
+	})
+
+	names := []string{"updated.txt", "unchanged.txt", "stale.txt", "none.txt", "failed.txt"}
+	var procs []*processor.Processor
+	var errs []error
+	for _, name := range names {
+		opts := shOptions()
+		opts.Check = name == "stale.txt"
+		p := processor.New(filepath.Join(dir, name), opts)
+		procs = append(procs, p)
+		errs = append(errs, p.Run())
+	}
+
+	r := newReport(procs, errs, 2*time.Second)
+	if r.Duration != 2 || len(r.Files) != len(names) {
+		t.Fatalf("NewReport: Expected 2 seconds and %d files, Got %v and %d", len(names), r.Duration, len(r.Files))
+	}
+	statuses := []string{"updated", "unchanged", "stale", "no-cog-code", "error"}
+	for i, f := range r.Files {
+		if f.File != procs[i].File || f.Status != statuses[i] {
+			t.Errorf("NewReport: Expected %s to be %s, Got %s %s", procs[i].File, statuses[i], f.File, f.Status)
+		}
+		if f.Changed != (i == 0 || i == 2) {
+			t.Errorf("NewReport: unexpected changed for %s: %v", f.File, f.Changed)
+		}
+		if (f.Error != "") != (i == 4) {
+			t.Errorf("NewReport: unexpected error for %s: %q", f.File, f.Error)
+		}
+		if (f.Diff != "") != (i == 2) {
+			t.Errorf("NewReport: unexpected diff for %s: %q", f.File, f.Diff)
+		}
+	}
+
+	ok := r.Files[0].Blocks
+	if len(ok) != 1 || ok[0].Block != 1 || ok[0].Status != "ok" || ok[0].ExitCode != 0 || ok[0].Bytes != len("hello\n") ||
+		!ok[0].Changed || len(ok[0].Command) != 2 || ok[0].Command[0] != "sh" {
+		t.Errorf("NewReport: unexpected block record for an updated file: %+v", ok)
+	}
+	failed := r.Files[4].Blocks
+	if len(failed) != 1 || failed[0].Status != "failed" || failed[0].ExitCode != 3 || failed[0].Stderr != "oops\n" ||
+		failed[0].Error == "" || bytes.Contains([]byte(failed[0].Error), []byte("oops")) {
+		t.Errorf("NewReport: unexpected block record for a failed generator: %+v", failed)
+	}
+	if len(r.Files[3].Blocks) != 0 || r.Files[3].Findings != nil {
+		t.Errorf("NewReport: Expected nothing about the blocks of a file with no gocog code, Got %+v", r.Files[3])
+	}
+	stale := r.Files[2].Findings
+	if len(stale) != 1 || stale[0].Rule != processor.StaleOutput || stale[0].Level != "error" || stale[0].Line != 1 || stale[0].EndLine != 4 {
+		t.Errorf("NewReport: Expected a stale output finding for lines 1-4, Got %+v", stale)
+	}
+}
+
+// keys returns the sorted keys of a JSON object.
+func keys(v interface{}) []string {
+	m, _ := v.(map[string]interface{})
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+func TestWriteJSONReport(t *testing.T) {
+	r := &runReport{
+		Duration: 1.5,
+		Files: []fileReport{{
+			File: "a.go", Status: "error", Changed: false, Duration: 0.25, Error: "Error generating code",
+			Blocks: []blockReport{{Block: 1, Status: "failed", Duration: 0.125, Command: []string{"go", "run", "x.go"},
+				ExitCode: 1, Stderr: "oops\n", Bytes: 0, Changed: false, Error: "exit status 1"}},
+			Findings: []finding{{Rule: processor.StrayEnd, Level: "warning", Message: "stray", Line: 3, EndLine: 3}},
+		}, {
+			File: "b.go", Status: "unchanged", Duration: 0.5, Blocks: []blockReport{},
+		}},
+	}
+	b := &bytes.Buffer{}
+	if err := writeJSONReport(b, r); err != nil {
+		t.Fatalf("WriteJSONReport: unexpected error: %v", err)
+	}
+
+	var v map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &v); err != nil {
+		t.Fatalf("WriteJSONReport: report is not valid JSON: %v\n%s", err, b)
+	}
+	check := func(what string, got, expected []string) {
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("WriteJSONReport: Expected %s fields %q, Got %q", what, expected, got)
+		}
+	}
+	check("report", keys(v), []string{"duration", "files"})
+	files := v["files"].([]interface{})
+	check("file", keys(files[0]), []string{"blocks", "changed", "duration", "error", "file", "findings", "status"})
+	// empty optional fields are left out, but blocks is always a list
+	check("file", keys(files[1]), []string{"blocks", "changed", "duration", "file", "status"})
+	if blocks, ok := files[1].(map[string]interface{})["blocks"].([]interface{}); !ok || len(blocks) != 0 {
+		t.Errorf("WriteJSONReport: Expected an empty list of blocks, Got %v", files[1])
+	}
+	block := files[0].(map[string]interface{})["blocks"].([]interface{})[0]
+	check("block", keys(block), []string{"block", "bytes", "changed", "command", "duration", "error", "exit_code", "status", "stderr"})
+	check("finding", keys(files[0].(map[string]interface{})["findings"].([]interface{})[0]),
+		[]string{"end_line", "level", "line", "message", "rule"})
+
+	var back runReport
+	if err := json.Unmarshal(b.Bytes(), &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.Files[0].Blocks[0].ExitCode != 1 || back.Files[0].Blocks[0].Duration != 0.125 || back.Duration != 1.5 {
+		t.Errorf("WriteJSONReport: report didn't round trip: %+v", back)
+	}
+}
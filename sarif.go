@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/natefinch/gocog/processor"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sarifSchema is the schema of the SARIF logs gocog writes.
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// The parts of a SARIF 2.1.0 log that gocog writes.
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           sarifRegion           `json:"region"`
+	}
+	sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn,omitempty"`
+		EndLine     int `json:"endLine"`
+	}
+)
+
+// writeSARIFReport writes the findings in the report as a SARIF log, for code scanning tools.
+func writeSARIFReport(w io.Writer, r *runReport) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "gocog",
+			InformationURI: "https://github.com/natefinch/gocog",
+			Rules:          sarifRules(),
+		}},
+		Results: []sarifResult{},
+	}
+	for _, f := range r.Files {
+		for _, fd := range f.Findings {
+			run.Results = append(run.Results, sarifResult{
+				RuleID:  fd.Rule,
+				Level:   fd.Level,
+				Message: sarifMessage{fd.Message},
+				Locations: []sarifLocation{{sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{sarifURI(f.File)},
+					Region:           sarifRegion{fd.Line, fd.Column, fd.EndLine},
+				}}},
+			})
+		}
+	}
+
+	b, err := json.MarshalIndent(sarifLog{sarifSchema, "2.1.0", []sarifRun{run}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// sarifRules returns the descriptions of the rules that findings may break, sorted by ID.
+func sarifRules() []sarifRule {
+	rules := make([]sarifRule, 0, len(processor.Rules))
+	for id, rule := range processor.Rules {
+		rules = append(rules, sarifRule{id, sarifMessage{rule.Description}})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules
+}
+
+// sarifURI returns the URI of the named file: a relative reference for a relative path,
+// so code scanning tools resolve it against the repository, or a file URI for an absolute one.
+func sarifURI(name string) string {
+	name = filepath.ToSlash(name)
+	if !filepath.IsAbs(filepath.FromSlash(name)) {
+		return (&url.URL{Path: strings.TrimPrefix(name, "./")}).String()
+	}
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	return (&url.URL{Scheme: "file", Path: name}).String()
+}
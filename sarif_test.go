@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/natefinch/gocog/processor"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteSARIFReport(t *testing.T) {
+	b := &bytes.Buffer{}
+	if err := writeSARIFReport(b, testReport); err != nil {
+		t.Fatalf("WriteSARIFReport: unexpected error: %v", err)
+	}
+
+	// the required properties, checked by name so renaming a struct field can't hide their loss
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &raw); err != nil {
+		t.Fatalf("WriteSARIFReport: report is not valid JSON: %v", err)
+	}
+	if raw["version"] != "2.1.0" || raw["$schema"] != sarifSchema {
+		t.Errorf("WriteSARIFReport: Expected version 2.1.0 and $schema %s, Got %v and %v", sarifSchema, raw["version"], raw["$schema"])
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(b.Bytes(), &log); err != nil {
+		t.Fatalf("WriteSARIFReport: unexpected error reading report: %v", err)
+	}
+	if len(log.Runs) != 1 {
+		t.Fatalf("WriteSARIFReport: Expected 1 run, Got %d", len(log.Runs))
+	}
+	run := log.Runs[0]
+	if run.Tool.Driver.Name != "gocog" || len(run.Tool.Driver.Rules) != len(processor.Rules) {
+		t.Errorf("WriteSARIFReport: Expected driver gocog with %d rules, Got %s with %d", len(processor.Rules), run.Tool.Driver.Name, len(run.Tool.Driver.Rules))
+	}
+
+	expected := []sarifResult{
+		{processor.StaleOutput, "error", sarifMessage{"The generated output of block 2 is out of date"},
+			[]sarifLocation{{sarifPhysicalLocation{sarifArtifactLocation{"stale.go"}, sarifRegion{7, 0, 10}}}}},
+		{processor.MissingEnd, "error", sarifMessage{"Block 1 has no end marker"},
+			[]sarifLocation{{sarifPhysicalLocation{sarifArtifactLocation{"broken.go"}, sarifRegion{2, 0, 2}}}}},
+		{processor.StrayEnd, "warning", sarifMessage{"End marker outside any block"},
+			[]sarifLocation{{sarifPhysicalLocation{sarifArtifactLocation{"broken.go"}, sarifRegion{5, 4, 5}}}}},
+	}
+	if len(run.Results) != len(expected) {
+		t.Fatalf("WriteSARIFReport: Expected %d results, Got %d: %+v", len(expected), len(run.Results), run.Results)
+	}
+	for i, res := range run.Results {
+		exp := expected[i]
+		if res.RuleID != exp.RuleID || res.Level != exp.Level || res.Message != exp.Message ||
+			len(res.Locations) != 1 || res.Locations[0] != exp.Locations[0] {
+			t.Errorf("WriteSARIFReport Test %d: Expected %+v, Got %+v", i, exp, res)
+		}
+	}
+
+	// a report with nothing found still has a results array, as SARIF requires
+	b.Reset()
+	if err := writeSARIFReport(b, &runReport{}); err != nil {
+		t.Fatalf("WriteSARIFReport: unexpected error: %v", err)
+	}
+	if !bytes.Contains(b.Bytes(), []byte(`"results": []`)) {
+		t.Errorf("WriteSARIFReport: Expected an empty results array, Got:\n%s", b)
+	}
+}
+
+func TestSARIFRegions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "stray.txt")
+	if err := ioutil.WriteFile(name, []byte("[[[end]]]\ntext\n  [[[end]]]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := processor.New(name, shOptions())
+	r := &runReport{Files: []fileReport{{File: name, Findings: findings(p, "error")}}}
+	b := &bytes.Buffer{}
+	if err := writeSARIFReport(b, r); err != nil {
+		t.Fatalf("SARIFRegions: unexpected error: %v", err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(b.Bytes(), &log); err != nil {
+		t.Fatalf("SARIFRegions: report is not valid JSON: %v", err)
+	}
+
+	// lines and columns count from 1: a marker at the very start of the file is at 1:1
+	expected := []sarifRegion{{1, 1, 1}, {3, 3, 3}}
+	results := log.Runs[0].Results
+	if len(results) != len(expected) {
+		t.Fatalf("SARIFRegions: Expected %d results, Got %d: %+v", len(expected), len(results), results)
+	}
+	for i, res := range results {
+		if region := res.Locations[0].PhysicalLocation.Region; region != expected[i] {
+			t.Errorf("SARIFRegions Test %d: Expected region %+v, Got %+v", i, expected[i], region)
+		}
+	}
+}
+
+type SARIFURIData struct {
+	name, uri string
+}
+
+func TestSARIFURI(t *testing.T) {
+	data := []SARIFURIData{
+		{"foo.go", "foo.go"},
+		{"./foo.go", "foo.go"},
+		{filepath.FromSlash("dir/foo bar.go"), "dir/foo%20bar.go"},
+		{"dir/100%.go", "dir/100%25.go"},
+	}
+	if runtime.GOOS == "windows" {
+		data = append(data, SARIFURIData{`C:\src\foo.go`, "file:///C:/src/foo.go"})
+	} else {
+		data = append(data, SARIFURIData{"/src/foo.go", "file:///src/foo.go"})
+	}
+	for i, d := range data {
+		if uri := sarifURI(d.name); uri != d.uri {
+			t.Errorf("SARIFURI Test %d: Expected %q, Got %q", i, d.uri, uri)
+		}
+	}
+}
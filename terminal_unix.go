@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "os"
+
+// enableEscapes makes the terminal f act on ANSI escape sequences, reporting whether it does,
+// and returns a func that puts the terminal back as it was. Unix terminals always do.
+func enableEscapes(f *os.File) (restore func(), ok bool) {
+	return func() {}, true
+}
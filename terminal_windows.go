@@ -0,0 +1,24 @@
+package main
+
+import (
+	"golang.org/x/sys/windows"
+	"os"
+)
+
+// enableEscapes makes the console f act on ANSI escape sequences, reporting whether it does,
+// and returns a func that puts the console back as it was. Consoles older than windows 10
+// can't, and would print the sequences as they are.
+func enableEscapes(f *os.File) (restore func(), ok bool) {
+	h := windows.Handle(f.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(h, &mode); err != nil {
+		return nil, false
+	}
+	if mode&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING != 0 {
+		return func() {}, true
+	}
+	if err := windows.SetConsoleMode(h, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING); err != nil {
+		return nil, false
+	}
+	return func() { windows.SetConsoleMode(h, mode) }, true
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/natefinch/gocog/processor"
+	"io"
+	"io/ioutil"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// slowest is the number of blocks listed by --timings.
+const slowest = 10
+
+// timedBlock is the result of a block, along with the file it's in.
+type timedBlock struct {
+	file string
+	processor.BlockResult
+}
+
+// total returns the time spent on the block, reading it and generating it.
+func (b timedBlock) total() time.Duration {
+	return b.Timings.Parse + b.Duration
+}
+
+// printTimings prints the slowest blocks of the run to w, and where their time went.
+func printTimings(w io.Writer, procs []*processor.Processor) {
+	var blocks []timedBlock
+	for _, p := range procs {
+		for _, res := range p.Results {
+			blocks = append(blocks, timedBlock{p.File, res})
+		}
+	}
+	if len(blocks) == 0 {
+		return
+	}
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].total() > blocks[j].total() })
+	if len(blocks) > slowest {
+		blocks = blocks[:slowest]
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "TOTAL\tPARSE\tWRITE\tWAIT\tEXEC\tOUTPUT\t\tBLOCK")
+	for _, b := range blocks {
+		t := b.Timings
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t\t%s:%d\n", ms(b.total()), ms(t.Parse), ms(t.Write),
+			ms(t.Wait), ms(t.Exec), ms(t.Output), b.file, b.N)
+	}
+	tw.Flush()
+}
+
+// ms formats the duration in milliseconds.
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
+
+// traceEvent is an event in the Chrome trace event format, as read by chrome://tracing and Perfetto.
+// Times are in microseconds.
+type traceEvent struct {
+	Name     string                 `json:"name"`
+	Category string                 `json:"cat,omitempty"`
+	Phase    string                 `json:"ph"`
+	Time     int64                  `json:"ts"`
+	Duration int64                  `json:"dur,omitempty"`
+	Process  int                    `json:"pid"`
+	Thread   int                    `json:"tid"`
+	Args     map[string]interface{} `json:"args,omitempty"`
+}
+
+// the trace's processes, which group the files and the generators
+const (
+	traceFiles = iota + 1
+	traceGenerators
+)
+
+// writeTrace writes a Chrome trace of the run that started at start to the named file, with
+// each file that had gocog code processed and each generator run, and the steps of each generator.
+// Files and generators that overlapped are shown in separate rows, which are named.
+func writeTrace(name string, procs []*processor.Processor, errs []error, start time.Time) error {
+	us := func(d time.Duration) int64 { return int64(d / time.Microsecond) }
+	events := []traceEvent{
+		{Name: "process_name", Phase: "M", Process: traceFiles, Args: map[string]interface{}{"name": "files"}},
+		{Name: "process_name", Phase: "M", Process: traceGenerators, Args: map[string]interface{}{"name": "generators"}},
+	}
+
+	var files, blocks lanes
+	for i, p := range procs {
+		if errs[i] == processor.NoCogCode || p.Start.IsZero() {
+			continue
+		}
+		events = append(events, traceEvent{
+			Name:     p.File,
+			Category: "file",
+			Phase:    "X",
+			Time:     us(p.Start.Sub(start)),
+			Duration: us(p.Duration),
+			Process:  traceFiles,
+			Thread:   files.take(p.Start, p.Duration),
+			Args:     map[string]interface{}{"blocks": len(p.Results)},
+		})
+		for _, res := range p.Results {
+			tid := blocks.take(res.Start, res.Duration)
+			events = append(events, traceEvent{
+				Name:     fmt.Sprintf("%s:%d", p.File, res.N),
+				Category: "block",
+				Phase:    "X",
+				Time:     us(res.Start.Sub(start)),
+				Duration: us(res.Duration),
+				Process:  traceGenerators,
+				Thread:   tid,
+				Args:     map[string]interface{}{"command": res.Command, "exit_code": res.ExitCode, "parse_us": us(res.Timings.Parse)},
+			})
+			// the steps follow each other from the start of the block
+			at := res.Start
+			for _, step := range []struct {
+				name string
+				d    time.Duration
+			}{
+				{"write generator", res.Timings.Write},
+				{"wait", res.Timings.Wait},
+				{"exec", res.Timings.Exec},
+				{"write output", res.Timings.Output},
+			} {
+				if us(step.d) > 0 {
+					events = append(events, traceEvent{
+						Name:     step.name,
+						Category: "step",
+						Phase:    "X",
+						Time:     us(at.Sub(start)),
+						Duration: us(step.d),
+						Process:  traceGenerators,
+						Thread:   tid,
+					})
+				}
+				at = at.Add(step.d)
+			}
+		}
+	}
+
+	for i := range files {
+		events = append(events, traceEvent{Name: "thread_name", Phase: "M", Process: traceFiles, Thread: i + 1,
+			Args: map[string]interface{}{"name": fmt.Sprintf("files %d", i+1)}})
+	}
+	for i := range blocks {
+		events = append(events, traceEvent{Name: "thread_name", Phase: "M", Process: traceGenerators, Thread: i + 1,
+			Args: map[string]interface{}{"name": fmt.Sprintf("generators %d", i+1)}})
+	}
+
+	b, err := json.MarshalIndent(struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{events, "ms"}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, append(b, '\n'), 0666)
+}
+
+// lanes assigns spans of time to rows of a trace, so that spans in the same row don't overlap.
+type lanes []time.Time
+
+// take returns the first row that's free from start for d, counting from 1, and marks it busy.
+func (l *lanes) take(start time.Time, d time.Duration) int {
+	for i, free := range *l {
+		if !start.Before(free) {
+			(*l)[i] = start.Add(d)
+			return i + 1
+		}
+	}
+	*l = append(*l, start.Add(d))
+	return len(*l)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/natefinch/gocog/processor"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrintTimings(t *testing.T) {
+	// a.go has blocks taking 1ms to 6ms, and b.go 7ms to 12ms, so the two fastest are left out
+	procs := []*processor.Processor{{File: "a.go"}, {File: "b.go"}}
+	for i := 1; i <= 12; i++ {
+		p := procs[(i-1)/6]
+		p.Results = append(p.Results, processor.BlockResult{N: len(p.Results) + 1, Duration: time.Duration(i) * time.Millisecond})
+	}
+	// the time spent reading a block counts toward its total
+	procs[0].Results[0].Timings.Parse = 20 * time.Millisecond
+
+	b := &bytes.Buffer{}
+	printTimings(b, procs)
+	lines := strings.Split(strings.TrimRight(b.String(), "\n"), "\n")
+	if len(lines) != slowest+1 {
+		t.Fatalf("PrintTimings: Expected a header and %d blocks, Got:\n%s", slowest, b)
+	}
+	if fields := strings.Fields(lines[0]); fields[0] != "TOTAL" || fields[len(fields)-1] != "BLOCK" {
+		t.Errorf("PrintTimings: Expected the header first, Got %q", lines[0])
+	}
+	expected := []string{"a.go:1", "b.go:6", "b.go:5", "b.go:4", "b.go:3", "b.go:2", "b.go:1", "a.go:6", "a.go:5", "a.go:4"}
+	for i, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if block := fields[len(fields)-1]; block != expected[i] {
+			t.Errorf("PrintTimings: Expected block %d to be %s, Got %q", i+1, expected[i], line)
+		}
+	}
+	if fields := strings.Fields(lines[1]); fields[0] != "21.0ms" || fields[1] != "20.0ms" {
+		t.Errorf("PrintTimings: Expected a total of 21.0ms with 20.0ms parsing, Got %q", lines[1])
+	}
+
+	b.Reset()
+	printTimings(b, []*processor.Processor{{File: "a.go"}})
+	if b.Len() != 0 {
+		t.Errorf("PrintTimings: Expected nothing without any blocks, Got:\n%s", b)
+	}
+}
+
+func TestWriteTrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+	procs := []*processor.Processor{
+		{File: "a.go", Start: at(1), Duration: ms(10), Results: []processor.BlockResult{
+			{N: 1, Command: []string{"go", "run"}, Start: at(2), Duration: ms(4),
+				Timings: processor.Timings{Write: ms(1), Exec: ms(3)}},
+		}},
+		// b.go overlaps a.go, and so does its block
+		{File: "b.go", Start: at(5), Duration: ms(10), Results: []processor.BlockResult{
+			{N: 1, Start: at(5), Duration: ms(2), Timings: processor.Timings{Exec: ms(2)}},
+		}},
+		// c.go has no gocog code, so it isn't in the trace
+		{File: "c.go", Start: at(6), Duration: ms(1)},
+	}
+	name := filepath.Join(dir, "trace.json")
+	if err := writeTrace(name, procs, []error{nil, nil, processor.NoCogCode}, start); err != nil {
+		t.Fatalf("WriteTrace: unexpected error: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace struct {
+		TraceEvents []map[string]interface{} `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(b, &trace); err != nil {
+		t.Fatalf("WriteTrace: Expected JSON, Got error %v:\n%s", err, b)
+	}
+
+	spans := map[string]map[string]interface{}{}
+	threads := map[string]bool{}
+	for _, e := range trace.TraceEvents {
+		switch e["ph"] {
+		case "X":
+			for _, key := range []string{"pid", "tid", "ts", "dur"} {
+				if _, ok := e[key].(float64); !ok {
+					t.Errorf("WriteTrace: Expected a number for %s in %v", key, e)
+				}
+			}
+			if e["cat"] != "step" {
+				spans[e["name"].(string)] = e
+			}
+		case "M":
+			if e["name"] == "thread_name" {
+				threads[fmt.Sprint(e["pid"], "/", e["tid"])] = true
+			}
+		default:
+			t.Errorf("WriteTrace: Unexpected event %v", e)
+		}
+	}
+
+	expected := []struct {
+		name     string
+		pid, tid int
+		ts, dur  int
+	}{
+		{"a.go", traceFiles, 1, 1000, 10000},
+		{"b.go", traceFiles, 2, 5000, 10000},
+		{"a.go:1", traceGenerators, 1, 2000, 4000},
+		{"b.go:1", traceGenerators, 2, 5000, 2000},
+	}
+	if len(spans) != len(expected) {
+		t.Errorf("WriteTrace: Expected %d files and blocks, Got %v", len(expected), spans)
+	}
+	for _, ex := range expected {
+		e := spans[ex.name]
+		if e == nil {
+			t.Errorf("WriteTrace: Expected an event for %s", ex.name)
+			continue
+		}
+		got := []interface{}{e["pid"], e["tid"], e["ts"], e["dur"]}
+		want := []interface{}{float64(ex.pid), float64(ex.tid), float64(ex.ts), float64(ex.dur)}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("WriteTrace: Expected pid, tid, ts and dur %v for %s, Got %v", want, ex.name, got)
+		}
+		if !threads[fmt.Sprint(e["pid"], "/", e["tid"])] {
+			t.Errorf("WriteTrace: Expected a thread name for the row of %s", ex.name)
+		}
+	}
+	if len(threads) != 4 {
+		t.Errorf("WriteTrace: Expected names for 2 rows of files and 2 of generators, Got %v", threads)
+	}
+}
+
+type LanesData struct {
+	start time.Time
+	d     time.Duration
+	lane  int
+}
+
+func TestLanes(t *testing.T) {
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+	var l lanes
+	tests := []LanesData{
+		{at(0), ms(10), 1},
+		// overlaps the first span
+		{at(5), ms(10), 2},
+		// starts as the first span ends, so reuses its lane
+		{at(10), ms(5), 1},
+		// both lanes are busy until 15ms
+		{at(12), ms(1), 3},
+		{at(15), ms(1), 1},
+		{at(15), ms(1), 2},
+	}
+	for i, test := range tests {
+		if lane := l.take(test.start, test.d); lane != test.lane {
+			t.Errorf("Lanes Test %d: Expected lane %d, Got %d", i, test.lane, lane)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// vetFinding is a finding of gocog vet, along with the file it's in.
+type vetFinding struct {
+	File string `json:"file"`
+	finding
+}
+
+// vetFiles runs gocog vet, checking the markers in each targeted file without running any generators.
+// It fails if anything is found.
+func vetFiles(mode, args []string) error {
+	opts, config, remaining, err := loadOptions(mode, args)
+	if err != nil {
+		return err
+	}
+	if err := setLogger(&opts.logOptions); err != nil {
+		return err
+	}
+	if opts.Format == "" {
+		opts.Format = "text"
+	}
+	if opts.Format != "text" && opts.Format != "json" && opts.Format != "sarif" {
+		return &usageError{fmt.Errorf("Unknown format '%s', expected text, json or sarif", opts.Format)}
+	}
+
+	procs, err := findTargets(config, &opts, remaining, mode, args)
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	report := &runReport{}
+	found := []vetFinding{}
+	for _, p := range procs {
+		lint, err := p.Lint()
+		if err != nil {
+			slog.Error("Error checking markers", "file", p.File, "err", err)
+			failed = true
+			continue
+		}
+		f := fileReport{File: p.File}
+		for _, l := range lint {
+			f.Findings = append(f.Findings, newFinding(l))
+			found = append(found, vetFinding{p.File, newFinding(l)})
+		}
+		report.Files = append(report.Files, f)
+	}
+
+	switch opts.Format {
+	case "json":
+		b, err := json.MarshalIndent(found, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", b)
+	case "sarif":
+		if err := writeSARIFReport(os.Stdout, report); err != nil {
+			return err
+		}
+	default:
+		for _, f := range found {
+			fmt.Printf("%s:%d:%d: %s: %s (%s)\n", f.File, f.Line, f.Column, f.Level, f.Message, f.Rule)
+		}
+	}
+
+	if failed || len(found) > 0 {
+		return errFailed
+	}
+	return nil
+}
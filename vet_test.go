@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/natefinch/gocog/processor"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// captureStdout returns what f writes to stdout, along with the error it returns.
+func captureStdout(t *testing.T, f func() error) (string, error) {
+	return capture(t, &os.Stdout, f)
+}
+
+// captureStderr returns what f writes to stderr, along with the error it returns.
+func captureStderr(t *testing.T, f func() error) (string, error) {
+	return capture(t, &os.Stderr, f)
+}
+
+// capture returns what f writes to the given file, along with the error it returns.
+func capture(t *testing.T, file **os.File, f func() error) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := *file
+	*file = w
+	out := make(chan string)
+	go func() {
+		b := &bytes.Buffer{}
+		io.Copy(b, r)
+		out <- b.String()
+	}()
+	err = f()
+	*file = orig
+	w.Close()
+	return <-out, err
+}
+
+func TestVetFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"clean.txt": "# [[[gocog\n# echo hello\n# gocog]]]\nhello\n# [[[end]]]\n",
+		"bad.txt":   "[[[end]]]\n# [[[gocog\n# echo hello\n# gocog]]]\n",
+	})
+	clean, bad := filepath.Join(dir, "clean.txt"), filepath.Join(dir, "bad.txt")
+	vet := func(args ...string) (string, error) {
+		return captureStdout(t, func() error {
+			return vetFiles(nil, append([]string{"--no-config", "-q"}, args...))
+		})
+	}
+
+	out, err := vet(clean)
+	if err != nil || out != "" {
+		t.Errorf("VetFiles: Expected nothing found in a clean file, Got %q and error %v", out, err)
+	}
+
+	out, err = vet(bad, clean)
+	if err != errFailed {
+		t.Errorf("VetFiles: Expected vet to fail with findings, Got %v", err)
+	}
+	expected := bad + ":1:1: warning: Marker [[[end]]] outside of any block (stray-end)\n" +
+		bad + ":2:3: error: Block 1 has no end marker before the end of the file (missing-end)\n"
+	if out != expected {
+		t.Errorf("VetFiles: Expected text:\n%s\nGot:\n%s", expected, out)
+	}
+
+	out, err = vet("--format=json", bad)
+	if err != errFailed {
+		t.Errorf("VetFiles: Expected vet to fail with findings, Got %v", err)
+	}
+	var found []map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &found); err != nil {
+		t.Fatalf("VetFiles: JSON output is not valid JSON: %v\n%s", err, out)
+	}
+	if len(found) != 2 {
+		t.Fatalf("VetFiles: Expected 2 JSON findings, Got %d:\n%s", len(found), out)
+	}
+	exp := map[string]interface{}{"file": bad, "rule": processor.MissingEnd, "level": "error", "line": 2.0, "column": 3.0, "end_line": 4.0}
+	for k, v := range exp {
+		if found[1][k] != v {
+			t.Errorf("VetFiles: Expected JSON field %s to be %v, Got %v", k, v, found[1][k])
+		}
+	}
+
+	out, err = vet("--format=sarif", bad)
+	if err != errFailed {
+		t.Errorf("VetFiles: Expected vet to fail with findings, Got %v", err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal([]byte(out), &log); err != nil {
+		t.Fatalf("VetFiles: SARIF output is not valid JSON: %v\n%s", err, out)
+	}
+	if len(log.Runs) != 1 || len(log.Runs[0].Results) != 2 || log.Runs[0].Results[0].RuleID != processor.StrayEnd {
+		t.Errorf("VetFiles: Expected a SARIF run with 2 results, Got:\n%s", out)
+	}
+
+	if _, err := vet("--format=xml", clean); err == nil {
+		t.Errorf("VetFiles: Expected an error for an unknown format")
+	}
+}
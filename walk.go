@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// binarySniffLen is how much of a file is checked for NUL bytes to decide whether it is binary, as git does.
+const binarySniffLen = 8000
+
+// skipDirs are directories that are never searched.
+var skipDirs = map[string]bool{".git": true, ".hg": true, ".svn": true, ".bzr": true}
+
+// expandTarget returns the files named by a target on the command line.
+// A target that is a directory, or that ends in /..., is searched recursively. A target containing
+// glob characters is matched against the files below the directory at the start of the pattern,
+// where ** matches any number of directories. Any other target is returned as is.
+// Files found by searching are filtered by the include and exclude patterns in the options,
+// and optionally by .gitignore files. Binary files are skipped. A target that is searched
+// but matches no files is warned about, since it's most likely a mistake.
+func expandTarget(target string, opts *options) ([]string, error) {
+	root, pattern := "", ""
+	switch {
+	case strings.HasSuffix(target, "/...") || target == "...":
+		root = strings.TrimSuffix(strings.TrimSuffix(target, "..."), "/")
+		if root == "" {
+			root = "."
+		}
+	case hasMeta(target):
+		root, pattern = splitGlob(filepath.ToSlash(target))
+	default:
+		if info, err := os.Stat(target); err != nil || !info.IsDir() {
+			return []string{target}, nil
+		}
+		root = target
+	}
+
+	files, err := walk(root, pattern, opts)
+	if err == nil && len(files) == 0 {
+		slog.Warn("No files found", "target", target)
+	}
+	return files, err
+}
+
+// hasMeta reports whether the path contains any glob characters.
+func hasMeta(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// splitGlob splits a slash separated glob pattern into the directory before the
+// first element containing glob characters, and the pattern after it.
+func splitGlob(pattern string) (root, rest string) {
+	parts := strings.Split(pattern, "/")
+	for i, part := range parts {
+		if hasMeta(part) {
+			root = strings.Join(parts[:i], "/")
+			if root == "" && i > 0 {
+				root = "/"
+			}
+			if root == "" {
+				root = "."
+			}
+			return filepath.FromSlash(root), strings.Join(parts[i:], "/")
+		}
+	}
+	return filepath.FromSlash(pattern), ""
+}
+
+// walk returns the files below root that match pattern (or all of them if pattern is empty),
+// and pass the include, exclude and .gitignore filters in the options. Files and directories
+// below root that can't be read are logged and skipped, so one bad entry doesn't stop the search.
+func walk(root, pattern string, opts *options) ([]string, error) {
+	var ignore *gitignore
+	if opts.GitIgnore {
+		var err error
+		if ignore, err = loadParentIgnores(root); err != nil {
+			return nil, err
+		}
+	}
+
+	var files []string
+	err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if name == root {
+				return err
+			}
+			slog.Warn("Skipping unreadable path", "path", name, "err", err)
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			if name != root && (skipDirs[info.Name()] || excluded(rel, opts.Exclude) || ignore.ignored(name, true)) {
+				return filepath.SkipDir
+			}
+			if ignore != nil {
+				return ignore.load(name)
+			}
+			return nil
+		}
+
+		if !info.Mode().IsRegular() || ignore.ignored(name, false) {
+			return nil
+		}
+		if pattern != "" && !matchGlob(pattern, rel) {
+			return nil
+		}
+		if !included(rel, opts.Include, opts.Exclude) {
+			return nil
+		}
+		binary, err := isBinary(name)
+		if err != nil {
+			slog.Warn("Skipping unreadable file", "file", name, "err", err)
+			return nil
+		}
+		if !binary {
+			files = append(files, name)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// included reports whether the slash separated path passes the include and exclude patterns.
+// If there are include patterns, the path must match one of them, and it must not match any
+// exclude pattern. Patterns without a slash are matched against the file's name.
+func included(rel string, include, exclude []string) bool {
+	if excluded(rel, exclude) {
+		return false
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		if matchName(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded reports whether the slash separated path matches any of the exclude patterns.
+// Directories are checked too, and nothing below an excluded directory is searched.
+func excluded(rel string, exclude []string) bool {
+	for _, pattern := range exclude {
+		if matchName(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchName matches a slash separated path against a pattern. A pattern containing
+// a slash must match the whole path, otherwise it is matched against the last element.
+func matchName(pattern, rel string) bool {
+	if strings.Contains(pattern, "/") {
+		return matchGlob(strings.TrimPrefix(pattern, "/"), rel)
+	}
+	ok, _ := path.Match(pattern, path.Base(rel))
+	return ok
+}
+
+// matchGlob reports whether the slash separated name matches the pattern, where
+// each element of the pattern is matched as by path.Match, and an element of **
+// matches zero or more elements of the name.
+func matchGlob(pattern, name string) bool {
+	return matchParts(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchParts(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchParts(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// isBinary reports whether the named file looks like a binary file, by checking
+// the start of the file for NUL bytes.
+func isBinary(name string) (bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, binarySniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return bytes.IndexByte(buf[:n], 0) >= 0, nil
+}
+
+// gitignore holds the rules from the .gitignore files that apply to a directory tree.
+// A nil *gitignore ignores nothing.
+type gitignore struct {
+	rules []ignoreRule
+}
+
+// ignoreRule is a single pattern from a .gitignore file.
+type ignoreRule struct {
+	dir     string // the directory holding the .gitignore file
+	pattern string
+	negate  bool
+	dirOnly bool
+}
+
+// loadParentIgnores loads the .gitignore files in root and the directories above it,
+// up to the top of the git repository containing root. If root is not in a git
+// repository, no rules are loaded.
+func loadParentIgnores(root string) (*gitignore, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for dir := abs; ; {
+		dirs = append(dirs, dir)
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			// not in a repository
+			return &gitignore{}, nil
+		}
+		dir = parent
+	}
+
+	g := &gitignore{}
+	// root itself is loaded by the walk, and outer files come first so inner rules take precedence
+	for i := len(dirs) - 1; i > 0; i-- {
+		if err := g.load(dirs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// load adds the rules from the .gitignore file in dir, if there is one.
+func (g *gitignore) load(dir string) error {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		rule := ignoreRule{dir: abs}
+		if line[0] == '!' {
+			rule.negate = true
+			line = line[1:]
+		} else if line[0] == '\\' {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		// a pattern with a slash anywhere but the end is relative to the .gitignore's directory,
+		// otherwise it matches a name at any depth
+		if !strings.Contains(line, "/") {
+			line = "**/" + line
+		}
+		rule.pattern = strings.TrimPrefix(line, "/")
+		g.rules = append(g.rules, rule)
+	}
+	return scanner.Err()
+}
+
+// ignored reports whether the named file or directory is ignored. The last rule matching it decides.
+func (g *gitignore) ignored(name string, isDir bool) bool {
+	if g == nil {
+		return false
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return false
+	}
+	ignored := false
+	for _, rule := range g.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(rule.dir, abs)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if matchGlob(rule.pattern, filepath.ToSlash(rel)) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
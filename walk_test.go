@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type SplitGlobData struct {
+	pattern string
+	root    string
+	rest    string
+}
+
+func TestSplitGlob(t *testing.T) {
+	tests := []SplitGlobData{
+		{"*.go", ".", "*.go"},
+		{"src/*.go", "src", "*.go"},
+		{"src/**/*.go", "src", "**/*.go"},
+		{"a/b[12]/c.go", "a", "b[12]/c.go"},
+		{"/abs/dir/*.go", "/abs/dir", "*.go"},
+		{"/*.go", "/", "*.go"},
+		{"a/b/c.go", "a/b/c.go", ""},
+	}
+
+	for i, test := range tests {
+		root, rest := splitGlob(test.pattern)
+		if root != filepath.FromSlash(test.root) || rest != test.rest {
+			t.Errorf("SplitGlob Test %d: Expected (%q, %q), Got (%q, %q)", i, filepath.FromSlash(test.root), test.rest, root, rest)
+		}
+	}
+}
+
+type MatchData struct {
+	pattern string
+	name    string
+	match   bool
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []MatchData{
+		{"*.go", "a.go", true},
+		{"*.go", "src/a.go", false},
+		{"src/*.go", "src/a.go", true},
+		{"src/*.go", "src/x/a.go", false},
+		// ** at the start
+		{"**/*.go", "a.go", true},
+		{"**/*.go", "x/y/a.go", true},
+		{"**/*.go", "x/y/a.txt", false},
+		// ** in the middle
+		{"src/**/gen.go", "src/gen.go", true},
+		{"src/**/gen.go", "src/a/b/gen.go", true},
+		{"src/**/gen.go", "lib/a/gen.go", false},
+		{"src/**/gen.go", "src/a/gen.go/x", false},
+		// ** at the end
+		{"src/**", "src", true},
+		{"src/**", "src/a", true},
+		{"src/**", "src/a/b.go", true},
+		{"src/**", "lib/a", false},
+		{"a/**/b/**/c", "a/x/b/y/z/c", true},
+		{"a/**/b/**/c", "a/x/y/z/c", false},
+		{"a/b[12]/c", "a/b2/c", true},
+		{"a/b[12]/c", "a/b3/c", false},
+	}
+
+	for i, test := range tests {
+		if match := matchGlob(test.pattern, test.name); match != test.match {
+			t.Errorf("MatchGlob Test %d: matchGlob(%q, %q) Expected %v, Got %v", i, test.pattern, test.name, test.match, match)
+		}
+	}
+}
+
+type IncludedData struct {
+	rel      string
+	include  []string
+	exclude  []string
+	included bool
+}
+
+func TestIncluded(t *testing.T) {
+	tests := []IncludedData{
+		{"a.go", nil, nil, true},
+		{"src/a.go", []string{"*.go"}, nil, true},
+		{"src/a.txt", []string{"*.go"}, nil, false},
+		{"src/a.txt", []string{"*.go", "*.txt"}, nil, true},
+		{"src/a.go", []string{"src/*.go"}, nil, true},
+		{"lib/src/a.go", []string{"src/*.go"}, nil, false},
+		{"lib/src/a.go", []string{"**/src/*.go"}, nil, true},
+		{"src/a.go", []string{"/src/*.go"}, nil, true},
+		{"src/a_test.go", []string{"*.go"}, []string{"*_test.go"}, false},
+		{"src/a.go", nil, []string{"src/**"}, false},
+		{"lib/a.go", nil, []string{"src/**"}, true},
+		{"vendor", nil, []string{"vendor"}, false},
+		{"src/vendor", nil, []string{"vendor"}, false},
+		{"vendor/a.go", nil, []string{"vendor"}, true},
+	}
+
+	for i, test := range tests {
+		if included := included(test.rel, test.include, test.exclude); included != test.included {
+			t.Errorf("Included Test %d: included(%q, %q, %q) Expected %v, Got %v", i, test.rel, test.include, test.exclude, test.included, included)
+		}
+	}
+}
+
+// writeFiles creates each of the slash separated files below dir with the given contents.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// relFiles returns the files relative to dir, in slash separated form.
+func relFiles(t *testing.T, dir string, files []string) []string {
+	var rels []string
+	for _, f := range files {
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	return rels
+}
+
+func TestWalkPrunesExcludedDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"a.go":              "",
+		"vendor/b.go":       "",
+		"src/c.go":          "",
+		"src/vendor/d.go":   "",
+		"src/gen/e.go":      "",
+		"src/gen/keep/f.go": "",
+		"bin.dat":           "\x00",
+	})
+
+	opts := &options{searchOptions: searchOptions{Exclude: []string{"vendor", "src/gen"}}}
+	files, err := walk(dir, "", opts)
+	if err != nil {
+		t.Fatalf("WalkPrunesExcludedDirs: unexpected error: %v", err)
+	}
+	if expected, got := []string{"a.go", "src/c.go"}, relFiles(t, dir, files); !reflect.DeepEqual(got, expected) {
+		t.Errorf("WalkPrunesExcludedDirs: Expected %q, Got %q", expected, got)
+	}
+}
+
+func TestExpandTargetWarnsWhenEmpty(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{"a.go": "", "empty/bin.dat": "\x00"})
+
+	defer slog.SetDefault(slog.Default())
+	b := &bytes.Buffer{}
+	slog.SetDefault(slog.New(slog.NewTextHandler(b, nil)))
+
+	opts := &options{}
+	for _, target := range []string{filepath.Join(dir, "**", "*.go"), dir, filepath.Join(dir, "a.go")} {
+		b.Reset()
+		if files, err := expandTarget(target, opts); err != nil || len(files) != 1 {
+			t.Errorf("ExpandTargetWarnsWhenEmpty: Expected one file for %s, Got %q, %v", target, files, err)
+		}
+		if b.Len() != 0 {
+			t.Errorf("ExpandTargetWarnsWhenEmpty: Expected no warning for %s, Got %s", target, b)
+		}
+	}
+	for _, target := range []string{filepath.Join(dir, "**", "*.txt"), filepath.Join(dir, "empty")} {
+		b.Reset()
+		if files, err := expandTarget(target, opts); err != nil || len(files) != 0 {
+			t.Errorf("ExpandTargetWarnsWhenEmpty: Expected no files for %s, Got %q, %v", target, files, err)
+		}
+		if !strings.Contains(b.String(), "No files found") {
+			t.Errorf("ExpandTargetWarnsWhenEmpty: Expected a warning for %s, Got %q", target, b)
+		}
+	}
+}
+
+func TestGitignore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{
+		".gitignore":     "# comment\n*.log\n!keep.log\nbuild/\n/top.txt\n\\#hash\ndocs/*.tmp  \r\n",
+		"sub/.gitignore": "local.txt\n!top.txt\n",
+	})
+
+	ignore, err := loadParentIgnores(filepath.Join(dir, "sub"))
+	if err != nil {
+		t.Fatalf("Gitignore: unexpected error loading parent ignores: %v", err)
+	}
+	if err := ignore.load(filepath.Join(dir, "sub")); err != nil {
+		t.Fatalf("Gitignore: unexpected error loading sub/.gitignore: %v", err)
+	}
+	if len(ignore.rules) != 8 {
+		t.Errorf("Gitignore: Expected 8 rules, Got %d: %+v", len(ignore.rules), ignore.rules)
+	}
+
+	tests := []struct {
+		name    string
+		isDir   bool
+		ignored bool
+	}{
+		{"a.log", false, true},
+		{"sub/deep/a.log", false, true},
+		{"keep.log", false, false},
+		{"sub/keep.log", false, false},
+		{"build", true, true},
+		{"sub/build", true, true},
+		{"build", false, false},
+		{"top.txt", false, true},
+		{"sub/top.txt", false, false},
+		{"#hash", false, true},
+		{"docs/a.tmp", false, true},
+		{"sub/docs/a.tmp", false, false},
+		{"local.txt", false, false},
+		{"sub/local.txt", false, true},
+		{"sub/x/local.txt", false, true},
+		{"a.go", false, false},
+	}
+	for i, test := range tests {
+		name := filepath.Join(dir, filepath.FromSlash(test.name))
+		if ignored := ignore.ignored(name, test.isDir); ignored != test.ignored {
+			t.Errorf("Gitignore Test %d: ignored(%q, %v) Expected %v, Got %v", i, test.name, test.isDir, test.ignored, ignored)
+		}
+	}
+
+	// outside a repository, parent .gitignore files don't apply
+	if err := os.Remove(filepath.Join(dir, ".git")); err != nil {
+		t.Fatal(err)
+	}
+	ignore, err = loadParentIgnores(filepath.Join(dir, "sub"))
+	if err != nil {
+		t.Fatalf("Gitignore: unexpected error loading parent ignores: %v", err)
+	}
+	if len(ignore.rules) != 0 {
+		t.Errorf("Gitignore: Expected no rules outside a repository, Got %+v", ignore.rules)
+	}
+}
+
+func TestNilGitignore(t *testing.T) {
+	var ignore *gitignore
+	if ignore.ignored("a.log", false) {
+		t.Error("NilGitignore: Expected a nil gitignore to ignore nothing")
+	}
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWalkSkipsUnreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read anything")
+	}
+	dir, err := ioutil.TempDir("", "gocog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{"a.go": "", "b.go": "", "locked/c.go": ""})
+	for _, name := range []string{"b.go", "locked"} {
+		if err := os.Chmod(filepath.Join(dir, name), 0); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chmod(filepath.Join(dir, name), 0755)
+	}
+
+	files, err := walk(dir, "", &options{})
+	if err != nil {
+		t.Fatalf("WalkSkipsUnreadable: unexpected error: %v", err)
+	}
+	if expected, got := []string{"a.go"}, relFiles(t, dir, files); !reflect.DeepEqual(got, expected) {
+		t.Errorf("WalkSkipsUnreadable: Expected %q, Got %q", expected, got)
+	}
+}